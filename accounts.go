@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fireflysync/internal/config"
+	"os"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+func accountsListCommand(args []string) error {
+	var accountType string
+	flags, configFile := newFlagSet("accounts list", "", "Lists the accounts of Firefly III, useful to find the names for the rules.")
+	flags.StringVar(&accountType, "type", "", "Only list accounts of this type, e.g. asset, expense or revenue")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usageError(flags, "too many arguments")
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return err
+	}
+
+	accounts, err := newClient(cfg).ListAccounts(accountType)
+	if err != nil {
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"ID", "Name", "Type", "IBAN"})
+	for _, account := range accounts {
+		table.Append([]string{account.ID, account.Attributes.Name, account.Attributes.Type, account.Attributes.IBAN})
+	}
+	table.Render()
+
+	return nil
+}
@@ -3,9 +3,8 @@ module fireflysync
 go 1.17
 
 require (
-	github.com/gocarina/gocsv v0.0.0-20210516172204-ca9e8a8ddea8
 	github.com/olekukonko/tablewriter v0.0.5
-	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fireflysync/internal/config"
+	"fireflysync/internal/csv"
+	"fireflysync/internal/firefly"
+	"fireflysync/internal/helper"
+	"fireflysync/internal/ledger"
+	"fireflysync/internal/report"
+	"fmt"
+	"log"
+)
+
+// defaultConcurrency is the number of transactions which are pushed at the same time
+const defaultConcurrency = 4
+
+// importJob is a row of the CSV file on its way to Firefly III
+type importJob struct {
+	input  csv.CsvTransaction
+	output firefly.FireflyTransaction
+	// skipped is the reason why the row isn't pushed, if it isn't
+	skipped string
+	// id is the ID of the created transaction group
+	id  int
+	err error
+}
+
+func importCommand(args []string) error {
+	var (
+		csvFile        string
+		profile        string
+		dryRun         bool
+		noMatch        bool
+		createAccounts bool
+		concurrency    int
+	)
+	flags, configFile := newFlagSet("import", "[csv file]", "Imports the transactions of a CSV file into Firefly III. Rows which were\nalready imported or exist in Firefly III are skipped.")
+	flags.StringVar(&csvFile, "csv", "", "Path to a CSV file to import")
+	flags.StringVar(&profile, "profile", "", "Name of the csv profile from the config file")
+	flags.BoolVar(&dryRun, "dry-run", false, "Dry run")
+	flags.BoolVar(&noMatch, "show-no-match", false, "Show only transactions that doesn't match any rules. Usefull with -dry-run")
+	flags.BoolVar(&createAccounts, "create-accounts", false, "Create an account named after the reciever for transactions with an IBAN\nwhich don't match any rule, same as create_accounts in the config")
+	flags.IntVar(&concurrency, "concurrency", 0, "Number of requests which are sent at the same time, same as http.concurrency\nin the config (default 4)")
+	reportOptions := addReportFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if err := reportOptions.validate(flags); err != nil {
+		return err
+	}
+	if concurrency < 0 {
+		return usageError(flags, "concurrency must not be negative")
+	}
+
+	if csvFile == "" && flags.NArg() == 1 {
+		csvFile = flags.Arg(0)
+	} else if flags.NArg() > 0 {
+		return usageError(flags, "too many arguments")
+	}
+	if csvFile == "" {
+		return usageError(flags, "csv file must be provided")
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return err
+	}
+	csvProfile, err := cfg.Profile(profile)
+	if err != nil {
+		return err
+	}
+	transactions, err := csv.ReadFile(csvFile, csvProfile)
+	if err != nil {
+		return err
+	}
+	if concurrency == 0 {
+		concurrency = cfg.HTTP.Concurrency
+	}
+	if concurrency == 0 {
+		concurrency = defaultConcurrency
+	}
+
+	client := newClient(cfg)
+	client.Fingerprints = make(map[string]bool, len(transactions))
+	for _, transaction := range transactions {
+		client.Fingerprints[transaction.Fingerprint] = true
+	}
+	importLedger, err := openLedger(cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := importLedger.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	var runID string
+	if !dryRun {
+		runID, err = importLedger.StartRun(csvFile)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Starting import run", runID)
+	}
+
+	// all rows are run through the rules before anything is sent
+	stats := report.New(cfg.Rules)
+	jobs := make([]*importJob, 0, len(transactions))
+	pending := []firefly.FireflyTransaction{}
+	// rows which are in the ledger but not done might have been created anyway,
+	// e.g. if the connection broke after the request was sent
+	known := []firefly.FireflyTransaction{}
+	for _, transaction := range transactions {
+		outputTransaction, err := firefly.ProcessTransaction(transaction, cfg.RuleSet, cfg.Defaults)
+		if err != nil {
+			return err
+		}
+		stats.Add(transaction, outputTransaction)
+
+		job := &importJob{input: transaction, output: outputTransaction}
+		jobs = append(jobs, job)
+		if importLedger.Done(transaction.Fingerprint) {
+			entry, _ := importLedger.Get(transaction.Fingerprint)
+			job.skipped = fmt.Sprint("Transaction already imported, skipping ", entry.FireflyID)
+			continue
+		}
+
+		// missing accounts are only created once the row is known to be pushed
+		if cfg.CreateAccounts || createAccounts {
+			if err := client.PlanCounterparty(&job.output, transaction.Reciever, transaction.IBAN); err != nil {
+				return fmt.Errorf("%s %s: %w", transaction.Date, transaction.Reciever, err)
+			}
+		}
+
+		if err := client.ResolveAccounts(&job.output, transaction.IBAN); err != nil {
+			return fmt.Errorf("%s %s: %w", transaction.Date, transaction.Reciever, err)
+		}
+		pending = append(pending, job.output)
+		if _, ok := importLedger.Get(transaction.Fingerprint); ok {
+			known = append(known, job.output)
+		}
+	}
+
+	if err := client.Prefetch(pending, concurrency); err != nil {
+		return err
+	}
+	if err := client.SearchExternalIDs(known, concurrency); err != nil {
+		return err
+	}
+
+	// duplicates are matched in the order of the CSV file, so the result
+	// doesn't depend on the order in which the transactions are pushed
+	for _, job := range jobs {
+		if job.skipped != "" {
+			continue
+		}
+		id, err := client.GetTransaction(job.output)
+		if err != nil {
+			return err
+		}
+		if id < 0 {
+			continue
+		}
+
+		job.skipped = fmt.Sprint("Transaction already exists, skipping ", id)
+		if !dryRun {
+			err := importLedger.Record(job.input.Fingerprint, ledger.Entry{FireflyID: id, Status: ledger.StatusDuplicate, RunID: runID})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, job := range jobs {
+		if job.skipped != "" {
+			continue
+		}
+		name, err := client.CreatePlannedAccount(&job.output, dryRun)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", job.input.Date, job.input.Reciever, err)
+		}
+		if name != "" && dryRun {
+			fmt.Printf("Account %q would be created with the IBAN %s\n", name, job.input.IBAN)
+		} else if name != "" {
+			fmt.Printf("Account %q created with the IBAN %s\n", name, job.input.IBAN)
+		}
+	}
+
+	push := func(job *importJob) {
+		job.id, job.err = client.PushTransaction(job.output)
+		if job.err != nil {
+			job.err = fmt.Errorf("%s %s: %w", job.input.Date, job.input.Reciever, job.err)
+			// record the failure, the row is retried on the next run
+			if err := importLedger.Record(job.input.Fingerprint, ledger.Entry{Status: ledger.StatusFailed, Error: job.err.Error(), RunID: runID}); err != nil {
+				log.Println(err)
+			}
+			return
+		}
+
+		job.err = importLedger.Record(job.input.Fingerprint, ledger.Entry{
+			FireflyID:   job.id,
+			Status:      ledger.StatusImported,
+			RunID:       runID,
+			Date:        job.output.Date.Format("2006-01-02"),
+			Amount:      job.output.Amount,
+			Description: job.output.Description,
+		})
+	}
+	if dryRun {
+		push = nil
+	}
+
+	print := func(job *importJob) {
+		if job.skipped != "" {
+			fmt.Println(job.skipped)
+			return
+		}
+		if job.id > 0 {
+			fmt.Println("Transaction created with ID: ", job.id)
+		}
+
+		// the report replaces the tables of the single transactions
+		if reportOptions.format != "" && reportOptions.file == "" {
+			return
+		}
+		if noMatch && job.output.RuleMatch {
+			return
+		}
+		helper.PrintTransaction(job.input, job.output)
+	}
+
+	if err := runJobs(jobs, concurrency, push, print); err != nil {
+		return err
+	}
+	return reportOptions.write(stats)
+}
+
+// runJobs pushes the transactions which aren't skipped with up to concurrency
+// workers and prints every job in the order of the CSV file as soon as all
+// jobs before it are done. After the first failure no new transactions are
+// pushed, the jobs which are already running are finished. It returns the
+// error of the first failed job in the order of the CSV file.
+func runJobs(jobs []*importJob, concurrency int, push, print func(job *importJob)) error {
+	finished := make(chan int)
+	done := make([]bool, len(jobs))
+	next, running, printed := 0, 0, 0
+	stopped := false
+	var failed error
+
+	for {
+		for !stopped && next < len(jobs) && running < concurrency {
+			i := next
+			next++
+			if jobs[i].skipped != "" || push == nil {
+				done[i] = true
+				continue
+			}
+			running++
+			go func() {
+				push(jobs[i])
+				finished <- i
+			}()
+		}
+
+		for printed < next && done[printed] {
+			job := jobs[printed]
+			printed++
+			if job.err != nil {
+				if failed == nil {
+					failed = job.err
+				} else {
+					log.Println(job.err)
+				}
+				continue
+			}
+			print(job)
+		}
+
+		if running == 0 {
+			return failed
+		}
+		i := <-finished
+		running--
+		done[i] = true
+		// stop pushing right away, the error is returned once the jobs before it were printed
+		if jobs[i].err != nil {
+			stopped = true
+		}
+	}
+}
@@ -1,51 +1,316 @@
 package config
 
 import (
+	"bytes"
+	"fireflysync/internal/csv"
+	"fireflysync/internal/money"
+	"fmt"
 	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	URL      string   `yaml:"url"`
-	Token    string   `yaml:"token"`
-	Rules    []Rule   `yaml:"rules"`
-	Defaults Defaults `yaml:"defaults"`
+	URL      string    `yaml:"url"`
+	Token    string    `yaml:"token"`
+	Rules    []Rule    `yaml:"rules"`
+	Defaults Defaults  `yaml:"defaults"`
+	CSV      CsvConfig `yaml:"csv"`
+	// DuplicateWindow is the number of days around the date of a transaction
+	// which are searched for already existing transactions
+	DuplicateWindow int `yaml:"duplicate_window"`
+	// Ledger is the path of the import ledger, relative to the config file
+	Ledger string `yaml:"ledger"`
+	// CreateAccounts creates an expense or revenue account for transactions
+	// without a matching rule, named after the reciever and with its IBAN
+	CreateAccounts bool       `yaml:"create_accounts"`
+	HTTP           HTTPConfig `yaml:"http"`
+
+	// RuleSet is the compiled form of Rules
+	RuleSet *RuleSet `yaml:"-"`
+
+	path  string
+	rules *yaml.Node
+}
+
+// ConfigError lists all problems found while loading a config file
+type ConfigError struct {
+	Path   string
+	Errors []error
+}
+
+func (e *ConfigError) Error() string {
+	lines := []string{fmt.Sprintf("%s has %d problems:", e.Path, len(e.Errors))}
+	for _, err := range e.Errors {
+		lines = append(lines, "  "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+type CsvConfig struct {
+	Profile  string                 `yaml:"profile"`
+	Profiles map[string]csv.Profile `yaml:"profiles"`
 }
 
 type Rule struct {
-	Data  RuleData  `yaml:"data"`
 	Match RuleMatch `yaml:"match"`
+	Data  RuleData  `yaml:"data"`
+	// Priority orders the rules, rules with a higher priority are tried first
+	Priority int `yaml:"priority,omitempty"`
+	// Continue keeps applying the following rules after this one matched
+	Continue bool `yaml:"continue,omitempty"`
 }
 
 type RuleData struct {
-	Internal    bool   `yaml:"internal"`
-	Destination string `yaml:"destination"`
-	Source      string `yaml:"source"`
-	Category    string `yaml:"category"`
-	Description string `yaml:"description"`
+	Internal    bool   `yaml:"internal,omitempty"`
+	Destination string `yaml:"destination,omitempty"`
+	Source      string `yaml:"source,omitempty"`
+	Category    string `yaml:"category,omitempty"`
+	Description string `yaml:"description,omitempty"`
+	// Tags are added to the transaction, the tags of all applied rules are combined
+	Tags      []string `yaml:"tags,omitempty"`
+	Notes     string   `yaml:"notes,omitempty"`
+	Budget    string   `yaml:"budget,omitempty"`
+	Bill      string   `yaml:"bill,omitempty"`
+	PiggyBank string   `yaml:"piggy_bank,omitempty"`
+	// InterestDate and BookDate are dates in the format 2006-01-02
+	InterestDate string `yaml:"interest_date,omitempty"`
+	BookDate     string `yaml:"book_date,omitempty"`
+	// Splits divide the transaction into several parts of one transaction group
+	Splits []Split `yaml:"splits,omitempty"`
+}
+
+// Split is a part of a transaction. Its amount is either a percentage of the
+// total amount, a fixed amount or the remainder which is left by all others.
+type Split struct {
+	Percent     *money.Amount `yaml:"percent,omitempty"`
+	Amount      *money.Amount `yaml:"amount,omitempty"`
+	Remainder   bool          `yaml:"remainder,omitempty"`
+	Destination string        `yaml:"destination,omitempty"`
+	Category    string        `yaml:"category,omitempty"`
+	Budget      string        `yaml:"budget,omitempty"`
+	Description string        `yaml:"description,omitempty"`
 }
 
+// IsEmpty reports if the rule doesn't set any data
+func (d RuleData) IsEmpty() bool {
+	if d.Internal || len(d.Tags) > 0 || len(d.Splits) > 0 {
+		return false
+	}
+	for _, field := range d.textFields() {
+		if *field.value != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// RuleMatch is a block of conditions which all have to match. The blocks
+// in all, any and not allow to combine conditions with boolean logic.
 type RuleMatch struct {
-	Reciever string `yaml:"reciever,omitempty"`
-	IBAN     string `yaml:"iban,omitempty"`
+	Reciever        string       `yaml:"reciever,omitempty"`
+	IBAN            string       `yaml:"iban,omitempty"`
+	Reference       string       `yaml:"reference,omitempty"`
+	Amount          *AmountMatch `yaml:"amount,omitempty"`
+	Weekday         []string     `yaml:"weekday,omitempty"`
+	Day             []int        `yaml:"day,omitempty"`
+	Currency        string       `yaml:"currency,omitempty"`
+	TransactionType string       `yaml:"transaction_type,omitempty"`
+	Category        string       `yaml:"category,omitempty"`
+	All             []RuleMatch  `yaml:"all,omitempty"`
+	Any             []RuleMatch  `yaml:"any,omitempty"`
+	Not             *RuleMatch   `yaml:"not,omitempty"`
+}
+
+// AmountMatch matches the absolute amount of a transaction, sign restricts
+// the direction to either "negative" (spending) or "positive" (receiving).
+type AmountMatch struct {
+	Min  *money.Amount `yaml:"min,omitempty"`
+	Max  *money.Amount `yaml:"max,omitempty"`
+	Sign string        `yaml:"sign,omitempty"`
 }
 
 type Defaults struct {
 	Destination string `yaml:"destination"`
 	Source      string `yaml:"source"`
+	Description string `yaml:"description"`
 }
 
-func GetConfig(path string) Config {
+// HTTPConfig controls how the requests are sent to Firefly III
+type HTTPConfig struct {
+	// Timeout of a single request, defaults to one minute
+	Timeout time.Duration `yaml:"timeout"`
+	// Retries is the number of times a request is repeated after a transient
+	// error, nil uses the default and 0 disables retries
+	Retries *int `yaml:"retries"`
+	// Backoff is the wait before the first retry, it doubles with every retry up to MaxBackoff
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	// RateLimit is the maximum number of requests per second, 0 means no limit
+	RateLimit float64 `yaml:"rate_limit"`
+	// Concurrency is the number of requests which are sent at the same time
+	// during an import, defaults to 4
+	Concurrency int `yaml:"concurrency"`
+}
+
+// DescriptionTemplate returns the template for the description of
+// transactions which don't match any rule.
+func (d Defaults) DescriptionTemplate() string {
+	if d.Description == "" {
+		return "Placeholder: {{.Reciever}}"
+	}
+	return d.Description
+}
+
+// Load reads the config file at the given path, compiles the rules and checks
+// everything for mistakes. All problems are reported at once as ConfigError.
+func Load(path string) (Config, error) {
 	var config Config
 	yamlFile, err := ioutil.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return config, err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(yamlFile, &root); err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+	rules := rulesNode(&root)
+
+	errs := []error{}
+	// lines with a value which couldn't be decoded, the zero value which was
+	// decoded instead isn't reported again by the rule compiler
+	invalid := map[int]bool{}
+	decoder := yaml.NewDecoder(bytes.NewReader(yamlFile))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		typeError, ok := err.(*yaml.TypeError)
+		if !ok {
+			return config, fmt.Errorf("%s: %w", path, err)
+		}
+		// unknown fields and values of the wrong type don't stop the decoder
+		for _, message := range typeError.Errors {
+			err := typeErrorToRuleError(message, rules, rulesEnd(&root))
+			if ruleErr, ok := err.(RuleError); ok {
+				invalid[ruleErr.Line] = true
+			}
+			errs = append(errs, err)
+		}
+	}
+	config.path = path
+	config.rules = rules
+
+	errs = append(errs, config.validate()...)
+
+	ruleSet, ruleErrs := CompileRules(config.Rules)
+	for _, err := range ruleErrs {
+		ruleErr := locate(err.(RuleError), rules)
+		if !invalid[ruleErr.Line] {
+			errs = append(errs, ruleErr)
+		}
+	}
+	config.RuleSet = ruleSet
+
+	if len(errs) > 0 {
+		return config, &ConfigError{Path: path, Errors: errs}
+	}
+	return config, nil
+}
+
+// Profile returns the import profile with the given name. An empty name
+// selects the configured default profile, or the built-in one if the config
+// doesn't define any profiles.
+func (c Config) Profile(name string) (csv.Profile, error) {
+	if name == "" {
+		name = c.CSV.Profile
+	}
+
+	if name == "" {
+		switch len(c.CSV.Profiles) {
+		case 0:
+			return csv.DefaultProfile, nil
+		case 1:
+			for _, profile := range c.CSV.Profiles {
+				return profile, nil
+			}
+		}
+		return csv.Profile{}, fmt.Errorf("multiple csv profiles configured, please select one")
+	}
+
+	profile, ok := c.CSV.Profiles[name]
+	if !ok {
+		return csv.Profile{}, fmt.Errorf("csv profile %q not found", name)
 	}
+	return profile, nil
+}
 
-	if err := yaml.Unmarshal(yamlFile, &config); err != nil {
-		panic(err)
+// LedgerPath returns the path of the import ledger, which is stored next to
+// the config file by default.
+func (c Config) LedgerPath() string {
+	if c.Ledger == "" {
+		return strings.TrimSuffix(c.path, filepath.Ext(c.path)) + ".ledger.json"
 	}
+	if filepath.IsAbs(c.Ledger) {
+		return c.Ledger
+	}
+	return filepath.Join(filepath.Dir(c.path), c.Ledger)
+}
 
-	return config
+// validate checks all settings besides the rules for mistakes
+func (c Config) validate() []error {
+	errs := []error{}
+	if c.URL == "" {
+		errs = append(errs, fmt.Errorf("url is missing"))
+	}
+	if c.Token == "" {
+		errs = append(errs, fmt.Errorf("token is missing"))
+	}
+
+	if c.CSV.Profile != "" {
+		if _, ok := c.CSV.Profiles[c.CSV.Profile]; !ok {
+			errs = append(errs, fmt.Errorf("csv: profile %q not found", c.CSV.Profile))
+		}
+	}
+	names := make([]string, 0, len(c.CSV.Profiles))
+	for name := range c.CSV.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		columns := c.CSV.Profiles[name].Columns
+		if columns.Date == (csv.Column{}) {
+			errs = append(errs, fmt.Errorf("csv profile %q: date column is missing", name))
+		}
+		if columns.Amount == (csv.Column{}) && columns.Debit == (csv.Column{}) && columns.Credit == (csv.Column{}) {
+			errs = append(errs, fmt.Errorf("csv profile %q: amount or debit and credit columns are missing", name))
+		}
+	}
+
+	if _, err := parseTemplate(c.Defaults.Description); err != nil {
+		errs = append(errs, fmt.Errorf("defaults.description: %w", err))
+	}
+
+	if c.HTTP.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("http.timeout must not be negative"))
+	}
+	if c.HTTP.Retries != nil && *c.HTTP.Retries < 0 {
+		errs = append(errs, fmt.Errorf("http.retries must not be negative"))
+	}
+	if c.HTTP.Backoff < 0 {
+		errs = append(errs, fmt.Errorf("http.backoff must not be negative"))
+	}
+	if c.HTTP.MaxBackoff < 0 {
+		errs = append(errs, fmt.Errorf("http.max_backoff must not be negative"))
+	}
+	if c.HTTP.RateLimit < 0 {
+		errs = append(errs, fmt.Errorf("http.rate_limit must not be negative"))
+	}
+	if c.HTTP.Concurrency < 0 {
+		errs = append(errs, fmt.Errorf("http.concurrency must not be negative"))
+	}
+	return errs
 }
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalRule returns the rule as YAML like it's written in the config
+func MarshalRule(rule Rule) (string, error) {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(rule); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// listItem turns the YAML of a rule into an item of a list with the given indentation
+func listItem(text string, indent int) string {
+	prefix := strings.Repeat(" ", indent)
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		if i == 0 {
+			lines[i] = prefix + "- " + line
+		} else {
+			lines[i] = prefix + "  " + line
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// isComment reports if the line is empty or a comment on the top level
+func isComment(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(line, "#")
+}
+
+// insertRule adds the rule to the end of the rules of the config file. The
+// rest of the file isn't touched, so all comments and formatting are kept.
+func insertRule(data []byte, rule Rule) ([]byte, error) {
+	text, err := MarshalRule(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	content := string(data)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	lines := strings.SplitAfter(content, "\n")
+	lines = lines[:len(lines)-1]
+
+	// find the rules and the key which follows them
+	var key, value, next *yaml.Node
+	if len(root.Content) > 0 && root.Content[0].Kind == yaml.MappingNode {
+		mapping := root.Content[0]
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if key != nil {
+				next = mapping.Content[i]
+				break
+			}
+			if mapping.Content[i].Value == "rules" {
+				key, value = mapping.Content[i], mapping.Content[i+1]
+			}
+		}
+	}
+
+	switch {
+	case key == nil:
+		return []byte(content + "rules:\n" + listItem(text, 0)), nil
+	case value.Kind == yaml.ScalarNode && value.Tag == "!!null" && value.Value == "":
+		return insertLines(lines, key.Line, listItem(text, 0)), nil
+	case value.Kind != yaml.SequenceNode || value.Style&yaml.FlowStyle != 0:
+		return nil, fmt.Errorf("line %d: rules have to be a list in block style to add a rule", key.Line)
+	}
+
+	indent := value.Content[0].Column - 3
+	if indent < 0 {
+		indent = 0
+	}
+
+	// the rules end before the next key and the comments which belong to it
+	end := len(lines)
+	if next != nil {
+		end = next.Line - 1
+	}
+	for end > key.Line && isComment(lines[end-1]) {
+		end--
+	}
+	return insertLines(lines, end, listItem(text, indent)), nil
+}
+
+// insertLines inserts the text after the given number of lines
+func insertLines(lines []string, after int, text string) []byte {
+	result := strings.Join(lines[:after], "") + text + strings.Join(lines[after:], "")
+	return []byte(result)
+}
+
+// AppendRule adds the rule to the end of the rules of the config file
+func AppendRule(path string, rule Rule) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	updated, err := insertRule(data, rule)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	// make sure the rule ended up where it belongs before the file is replaced
+	var before, after Config
+	if err := yaml.Unmarshal(data, &before); err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(updated, &after); err != nil || len(after.Rules) != len(before.Rules)+1 {
+		return fmt.Errorf("%s: failed to add the rule to the config file", path)
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(updated); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), info.Mode()); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
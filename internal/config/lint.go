@@ -0,0 +1,277 @@
+package config
+
+import (
+	"errors"
+	"fireflysync/internal/csv"
+	"fmt"
+	"reflect"
+	"regexp/syntax"
+	"strings"
+)
+
+// maxExpansions limits the number of texts a pattern is expanded to
+const maxExpansions = 100
+
+// expand returns all texts a pattern without any repetition can match, e.g.
+// "Rewe|Real" results in "Rewe" and "Real". ok is false for all other patterns.
+func expand(re *syntax.Regexp) (texts []string, ok bool) {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return []string{""}, true
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}, true
+	case syntax.OpCapture:
+		return expand(re.Sub[0])
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			for char := re.Rune[i]; char <= re.Rune[i+1]; char++ {
+				texts = append(texts, string(char))
+				if len(texts) > maxExpansions {
+					return nil, false
+				}
+			}
+		}
+		return texts, true
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			subTexts, ok := expand(sub)
+			if !ok {
+				return nil, false
+			}
+			texts = append(texts, subTexts...)
+		}
+		return texts, len(texts) <= maxExpansions
+	case syntax.OpConcat:
+		texts = []string{""}
+		for _, sub := range re.Sub {
+			subTexts, ok := expand(sub)
+			if !ok {
+				return nil, false
+			}
+			combined := []string{}
+			for _, prefix := range texts {
+				for _, suffix := range subTexts {
+					combined = append(combined, prefix+suffix)
+				}
+			}
+			if len(combined) > maxExpansions {
+				return nil, false
+			}
+			texts = combined
+		}
+		return texts, true
+	}
+	return nil, false
+}
+
+// literalPattern returns the texts of a pattern which only consists of
+// literal alternatives and if it ignores case.
+func literalPattern(pattern string) ([]string, bool, bool) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, false, false
+	}
+
+	// case insensitivity is only supported for the whole pattern
+	foldCase := strings.HasPrefix(pattern, "(?i)")
+	if !foldCase && strings.Contains(pattern, "(?") {
+		return nil, false, false
+	}
+
+	texts, ok := expand(re.Simplify())
+	if !ok {
+		return nil, false, false
+	}
+	if foldCase {
+		for i, text := range texts {
+			texts[i] = strings.ToLower(text)
+		}
+	}
+	return texts, foldCase, true
+}
+
+// subsumes reports if every text which matches the pattern other also
+// matches the pattern. Only patterns of literal alternatives are compared,
+// for all others it returns false.
+func subsumes(pattern, other string) bool {
+	texts, foldCase, ok := literalPattern(pattern)
+	if !ok {
+		return false
+	}
+	otherTexts, otherFoldCase, ok := literalPattern(other)
+	if !ok || (otherFoldCase && !foldCase) {
+		return false
+	}
+
+	for _, otherText := range otherTexts {
+		if foldCase {
+			otherText = strings.ToLower(otherText)
+		}
+		covered := false
+		for _, text := range texts {
+			if strings.Contains(otherText, text) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// hasConditions reports if the block contains any condition besides iban and reciever
+func (m *matcher) hasConditions() bool {
+	return m.reference != nil || m.transactionType != nil || m.category != nil || m.amount != nil ||
+		len(m.weekdays) > 0 || len(m.days) > 0 || m.currency != "" ||
+		len(m.all) > 0 || len(m.any) > 0 || m.not != nil
+}
+
+// covers reports if the rule always matches in the pass when the other rule does
+func (r *compiledRule) covers(other *compiledRule, pass int) bool {
+	if r.next || r.match.hasConditions() {
+		return false
+	}
+	switch pass {
+	case passIBAN:
+		return r.match.iban == other.match.iban
+	case passReciever:
+		return r.match.reciever.String() == other.match.reciever.String() ||
+			subsumes(r.match.reciever.String(), other.match.reciever.String())
+	}
+	return false
+}
+
+// shadowedBy returns the rule which always matches before the given rule, so
+// that it's never applied, or nil if there is none.
+func (s *RuleSet) shadowedBy(rule *compiledRule) *compiledRule {
+	var shadow *compiledRule
+	for i, current := range s.steps {
+		if current.rule != rule {
+			continue
+		}
+
+		found := false
+		for _, earlier := range s.steps[:i] {
+			if earlier.rule != rule && earlier.pass == current.pass && earlier.rule.covers(rule, current.pass) {
+				if shadow == nil {
+					shadow = earlier.rule
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return shadow
+}
+
+// withoutRecieverAndIBAN returns the conditions of the block besides iban and reciever
+func (m RuleMatch) withoutRecieverAndIBAN() RuleMatch {
+	m.IBAN = ""
+	m.Reciever = ""
+	return m
+}
+
+// Lint looks for rules which are valid but most likely not what was intended:
+// rules without data, IBANs which are used with different destinations,
+// identical or overlapping patterns and rules which are never applied.
+func (c Config) Lint() []error {
+	if c.RuleSet == nil {
+		return nil
+	}
+
+	compiled := make(map[int]*compiledRule)
+	for _, rule := range c.RuleSet.rules {
+		compiled[rule.index] = rule
+	}
+
+	errs := []error{}
+	fail := func(rule int, field string, format string, args ...interface{}) {
+		err := RuleError{Rule: rule, Field: field, Err: fmt.Errorf(format, args...)}
+		errs = append(errs, locate(err, c.rules))
+	}
+
+	for i, rule := range c.Rules {
+		if rule.Data.IsEmpty() {
+			fail(i, "data", "is empty, the rule only keeps the following rules from matching")
+		}
+
+		shadow := (*compiledRule)(nil)
+		if current, ok := compiled[i]; ok {
+			shadow = c.RuleSet.shadowedBy(current)
+		}
+
+		for j, earlier := range c.Rules[:i] {
+			if rule.Match.IBAN != "" && rule.Match.IBAN == earlier.Match.IBAN &&
+				rule.Data.Destination != earlier.Data.Destination &&
+				reflect.DeepEqual(rule.Match.withoutRecieverAndIBAN(), earlier.Match.withoutRecieverAndIBAN()) {
+				fail(i, "match.iban", "%s is also used by rule %d with the destination %q instead of %q", rule.Match.IBAN, j+1, earlier.Data.Destination, rule.Data.Destination)
+			}
+
+			if rule.Match.Reciever == "" || earlier.Match.Reciever == "" {
+				continue
+			}
+			if shadow != nil && shadow.index == j {
+				continue
+			}
+			if rule.Match.Reciever == earlier.Match.Reciever {
+				fail(i, "match.reciever", "pattern is identical to the one of rule %d", j+1)
+			} else if subsumes(earlier.Match.Reciever, rule.Match.Reciever) {
+				fail(i, "match.reciever", "every reciever which matches also matches %q of rule %d", earlier.Match.Reciever, j+1)
+			}
+		}
+
+		if shadow != nil {
+			fail(i, "match", "is never applied, rule %d always matches first", shadow.index+1)
+		}
+	}
+	return errs
+}
+
+// LintTransactions applies the rules to the transactions and reports all
+// rules which were never applied to any of them.
+func (c Config) LintTransactions(transactions []csv.CsvTransaction) ([]error, error) {
+	if c.RuleSet == nil {
+		return nil, errors.New("rules are not compiled")
+	}
+
+	applied := make(map[int]int)
+	matched := make(map[int]int)
+	for _, transaction := range transactions {
+		result, ok, err := c.RuleSet.Match(transaction)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			for _, rule := range result.Rules {
+				applied[rule]++
+			}
+		}
+
+		for _, rule := range c.RuleSet.rules {
+			for pass := passIBAN; pass <= passConditions; pass++ {
+				if rule.match.inPass(pass) && rule.match.matchesPass(pass, transaction, Captures{}) {
+					matched[rule.index]++
+					break
+				}
+			}
+		}
+	}
+
+	errs := []error{}
+	for _, rule := range c.RuleSet.rules {
+		if applied[rule.index] > 0 {
+			continue
+		}
+		err := RuleError{Rule: rule.index, Field: "match", Err: errors.New("didn't match any transaction of the csv file")}
+		if matched[rule.index] > 0 {
+			err.Err = fmt.Errorf("matched %d transactions of the csv file, but other rules always matched first", matched[rule.index])
+		}
+		errs = append(errs, locate(err, c.rules))
+	}
+	return errs, nil
+}
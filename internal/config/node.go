@@ -0,0 +1,113 @@
+package config
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// rulesNode returns the sequence node of the rules or nil if there are none
+func rulesNode(root *yaml.Node) *yaml.Node {
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil
+	}
+	node := mappingValue(root.Content[0], "rules")
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return node
+}
+
+// rulesEnd returns the line of the top-level key after the rules, which is
+// the first line which doesn't belong to them, or 0 if the rules are last
+func rulesEnd(root *yaml.Node) int {
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return 0
+	}
+	mapping := root.Content[0]
+	for i := 0; i+2 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == "rules" {
+			return mapping.Content[i+2].Line
+		}
+	}
+	return 0
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+var typeErrorLine = regexp.MustCompile(`^line (\d+): `)
+
+var pathElement = regexp.MustCompile(`^([^\[]+)(?:\[(\d+)\])?$`)
+
+// lookupNode follows a path like match.all[0].reciever and returns the
+// deepest node which exists along the path.
+func lookupNode(node *yaml.Node, path string) *yaml.Node {
+	if path == "" {
+		return node
+	}
+
+	for _, element := range strings.Split(path, ".") {
+		parts := pathElement.FindStringSubmatch(element)
+		if parts == nil {
+			return node
+		}
+
+		value := mappingValue(node, parts[1])
+		if value == nil {
+			return node
+		}
+		node = value
+
+		if parts[2] != "" {
+			index, _ := strconv.Atoi(parts[2])
+			if node.Kind != yaml.SequenceNode || index >= len(node.Content) {
+				return node
+			}
+			node = node.Content[index]
+		}
+	}
+	return node
+}
+
+// locate sets the line of the rule error if it isn't known yet
+func locate(err RuleError, rules *yaml.Node) RuleError {
+	if err.Line == 0 && rules != nil && err.Rule < len(rules.Content) {
+		err.Line = lookupNode(rules.Content[err.Rule], err.Field).Line
+	}
+	return err
+}
+
+// typeErrorToRuleError turns a message of a yaml.TypeError into a RuleError
+// if it belongs to one of the rules, which end before the line end.
+func typeErrorToRuleError(message string, rules *yaml.Node, end int) error {
+	parts := typeErrorLine.FindStringSubmatch(message)
+	if parts == nil || rules == nil {
+		return errors.New(message)
+	}
+
+	line, _ := strconv.Atoi(parts[1])
+	rule := -1
+	for i, node := range rules.Content {
+		if node.Line <= line {
+			rule = i
+		}
+	}
+	if rule < 0 || line < rules.Line || (end > 0 && line >= end) {
+		return errors.New(message)
+	}
+
+	return RuleError{Rule: rule, Line: line, Err: errors.New(strings.TrimPrefix(message, parts[0]))}
+}
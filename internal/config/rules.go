@@ -0,0 +1,547 @@
+package config
+
+import (
+	"fireflysync/internal/csv"
+	"fireflysync/internal/money"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// RuleError describes a problem of a single rule
+type RuleError struct {
+	// Rule is the index of the rule in the config, starting at 0
+	Rule int
+	// Line is the line of the problem in the config file, if it's known
+	Line int
+	// Field is the path of the field inside the rule, e.g. match.all[0].reciever
+	Field string
+	Err   error
+}
+
+func (e RuleError) Error() string {
+	location := fmt.Sprintf("rule %d", e.Rule+1)
+	if e.Line > 0 {
+		location += fmt.Sprintf(" (line %d)", e.Line)
+	}
+	if e.Field != "" {
+		return fmt.Sprintf("%s: %s: %s", location, e.Field, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", location, e.Err)
+}
+
+func (e RuleError) Unwrap() error {
+	return e.Err
+}
+
+// Captures holds the capture groups of all regular expressions which matched,
+// named groups by their name and all others by their number.
+type Captures map[string]string
+
+func (c Captures) merge(other Captures) {
+	for key, value := range other {
+		c[key] = value
+	}
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(name)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// matcher is the compiled form of a RuleMatch
+type matcher struct {
+	iban            string
+	reciever        *regexp.Regexp
+	reference       *regexp.Regexp
+	transactionType *regexp.Regexp
+	category        *regexp.Regexp
+	amount          *AmountMatch
+	weekdays        []time.Weekday
+	days            []int
+	currency        string
+	all             []*matcher
+	any             []*matcher
+	not             *matcher
+}
+
+// IsEmpty reports if the block doesn't contain any condition
+func (m RuleMatch) IsEmpty() bool {
+	return m.IBAN == "" && m.Reciever == "" && !m.hasConditions()
+}
+
+// hasConditions reports if the block contains any condition besides iban and reciever
+func (m RuleMatch) hasConditions() bool {
+	return m.Reference != "" || m.Amount != nil || len(m.Weekday) > 0 || len(m.Day) > 0 ||
+		m.Currency != "" || m.TransactionType != "" || m.Category != "" ||
+		len(m.All) > 0 || len(m.Any) > 0 || m.Not != nil
+}
+
+// compiler collects all problems of a single rule while it's compiled
+type compiler struct {
+	rule int
+	errs []error
+}
+
+func (c *compiler) fail(field string, format string, args ...interface{}) {
+	c.errs = append(c.errs, RuleError{Rule: c.rule, Field: field, Err: fmt.Errorf(format, args...)})
+}
+
+func (c *compiler) pattern(field, pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	expression, err := regexp.Compile(pattern)
+	if err != nil {
+		c.errs = append(c.errs, RuleError{Rule: c.rule, Field: field, Err: err})
+	}
+	return expression
+}
+
+func (c *compiler) match(m RuleMatch, path string) *matcher {
+	if m.IsEmpty() {
+		c.fail(path, "no conditions")
+	}
+
+	compiled := &matcher{
+		iban:            m.IBAN,
+		reciever:        c.pattern(path+".reciever", m.Reciever),
+		reference:       c.pattern(path+".reference", m.Reference),
+		transactionType: c.pattern(path+".transaction_type", m.TransactionType),
+		category:        c.pattern(path+".category", m.Category),
+		amount:          m.Amount,
+		days:            m.Day,
+		currency:        strings.ToUpper(m.Currency),
+	}
+
+	if m.Amount != nil {
+		if m.Amount.Sign != "" && m.Amount.Sign != "negative" && m.Amount.Sign != "positive" {
+			c.fail(path+".amount.sign", "must be negative or positive, not %q", m.Amount.Sign)
+		}
+		if m.Amount.Min != nil && m.Amount.Max != nil && m.Amount.Min.Cmp(*m.Amount.Max) > 0 {
+			c.fail(path+".amount", "min %s is greater than max %s", m.Amount.Min, m.Amount.Max)
+		}
+	}
+	for i, name := range m.Weekday {
+		weekday, ok := parseWeekday(name)
+		if !ok {
+			c.fail(fmt.Sprintf("%s.weekday[%d]", path, i), "unknown weekday %q", name)
+		}
+		compiled.weekdays = append(compiled.weekdays, weekday)
+	}
+	for i, day := range m.Day {
+		if day < 1 || day > 31 {
+			c.fail(fmt.Sprintf("%s.day[%d]", path, i), "%d is not a day of the month", day)
+		}
+	}
+
+	for i, block := range m.All {
+		compiled.all = append(compiled.all, c.match(block, fmt.Sprintf("%s.all[%d]", path, i)))
+	}
+	for i, block := range m.Any {
+		compiled.any = append(compiled.any, c.match(block, fmt.Sprintf("%s.any[%d]", path, i)))
+	}
+	if m.Not != nil {
+		compiled.not = c.match(*m.Not, path+".not")
+	}
+	return compiled
+}
+
+func (c *compiler) templates(data RuleData) map[string]*template.Template {
+	templates := make(map[string]*template.Template)
+	for _, field := range data.textFields() {
+		if !strings.Contains(*field.value, "{{") {
+			continue
+		}
+		tmpl, err := parseTemplate(*field.value)
+		if err != nil {
+			c.errs = append(c.errs, RuleError{Rule: c.rule, Field: "data." + field.name, Err: err})
+			continue
+		}
+		templates[field.name] = tmpl
+	}
+
+	for _, field := range data.dateFields() {
+		if *field.value == "" || strings.Contains(*field.value, "{{") {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", *field.value); err != nil {
+			c.fail("data."+field.name, "%q is not a date like 2006-01-02", *field.value)
+		}
+	}
+	return templates
+}
+
+func (c *compiler) splits(splits []Split) {
+	if len(splits) == 0 {
+		return
+	}
+	if len(splits) == 1 {
+		c.fail("data.splits", "at least two splits are required")
+	}
+
+	hundred := money.MustParse("100")
+	percent := money.Amount{}
+	remainders, amounts := 0, 0
+	for i, split := range splits {
+		field := fmt.Sprintf("data.splits[%d]", i)
+		set := 0
+		if split.Percent != nil {
+			set++
+			if split.Percent.Sign() <= 0 || split.Percent.Cmp(hundred) > 0 {
+				c.fail(field+".percent", "must be greater than 0 and at most 100, not %s", split.Percent)
+			}
+			percent = percent.Add(*split.Percent)
+		}
+		if split.Amount != nil {
+			set++
+			amounts++
+			if split.Amount.Sign() <= 0 {
+				c.fail(field+".amount", "must be greater than 0, not %s", split.Amount)
+			}
+		}
+		if split.Remainder {
+			set++
+			remainders++
+		}
+		if set != 1 {
+			c.fail(field, "exactly one of percent, amount or remainder is required")
+		}
+	}
+
+	if remainders > 1 {
+		c.fail("data.splits", "only one split can take the remainder")
+	}
+	if percent.Cmp(hundred) > 0 {
+		c.fail("data.splits", "percentages add up to %s, which is more than 100", percent)
+	} else if amounts > 0 && percent.Equal(hundred) {
+		c.fail("data.splits", "percentages add up to 100, which leaves nothing for the fixed amounts")
+	} else if remainders > 0 && percent.Equal(hundred) {
+		c.fail("data.splits", "percentages add up to 100, which leaves nothing for the remainder")
+	} else if remainders == 0 && amounts == 0 && !percent.Equal(hundred) {
+		c.fail("data.splits", "percentages add up to %s instead of 100 and no split takes the remainder", percent)
+	}
+}
+
+// matchPattern reports if the regular expression matches the value, a missing
+// pattern matches everything while an empty value never matches a pattern.
+func matchPattern(expression *regexp.Regexp, value string, captures Captures) bool {
+	if expression == nil {
+		return true
+	}
+	if value == "" {
+		return false
+	}
+
+	submatches := expression.FindStringSubmatch(value)
+	if submatches == nil {
+		return false
+	}
+
+	for i, name := range expression.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		captures[name] = submatches[i]
+	}
+	return true
+}
+
+func (m *matcher) matchesIBAN(transaction csv.CsvTransaction) bool {
+	return m.iban == "" || (transaction.IBAN != "" && m.iban == transaction.IBAN)
+}
+
+func (m *matcher) matchesReciever(transaction csv.CsvTransaction, captures Captures) bool {
+	return matchPattern(m.reciever, transaction.Reciever, captures)
+}
+
+func (a AmountMatch) matches(transaction csv.CsvTransaction) bool {
+	switch a.Sign {
+	case "negative":
+		if transaction.Amount.Sign() >= 0 {
+			return false
+		}
+	case "positive":
+		if transaction.Amount.Sign() <= 0 {
+			return false
+		}
+	}
+
+	amount := transaction.Amount.Abs()
+	if a.Min != nil && amount.Cmp(*a.Min) < 0 {
+		return false
+	}
+	return a.Max == nil || amount.Cmp(*a.Max) <= 0
+}
+
+func (m *matcher) matchesDate(transaction csv.CsvTransaction) bool {
+	if len(m.weekdays) > 0 {
+		matched := false
+		for _, weekday := range m.weekdays {
+			if weekday == transaction.Date.Weekday() {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(m.days) > 0 {
+		matched := false
+		for _, day := range m.days {
+			if day == transaction.Date.Day() {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesConditions reports if all conditions besides iban and reciever match
+func (m *matcher) matchesConditions(transaction csv.CsvTransaction, captures Captures) bool {
+	if !matchPattern(m.reference, transaction.Reference, captures) ||
+		!matchPattern(m.transactionType, transaction.TransactionType, captures) ||
+		!matchPattern(m.category, transaction.Category, captures) {
+		return false
+	}
+
+	if m.amount != nil && !m.amount.matches(transaction) {
+		return false
+	}
+
+	if !m.matchesDate(transaction) {
+		return false
+	}
+
+	if m.currency != "" && m.currency != strings.ToUpper(transaction.ForeignCurrency) {
+		return false
+	}
+
+	for _, block := range m.all {
+		if !block.matches(transaction, captures) {
+			return false
+		}
+	}
+
+	if len(m.any) > 0 {
+		matched := false
+		for _, block := range m.any {
+			// only keep the captures of the block which matched
+			blockCaptures := Captures{}
+			if block.matches(transaction, blockCaptures) {
+				captures.merge(blockCaptures)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return m.not == nil || !m.not.matches(transaction, Captures{})
+}
+
+// matches reports if all conditions of the block match the transaction
+func (m *matcher) matches(transaction csv.CsvTransaction, captures Captures) bool {
+	return m.matchesIBAN(transaction) && m.matchesReciever(transaction, captures) && m.matchesConditions(transaction, captures)
+}
+
+// Rules are tried in three passes. On the top level of a rule iban and
+// reciever keep their original meaning: either of them is enough for a match
+// and all rules are tried by IBAN first, then by reciever and only then the
+// rules without any of them. The passes are repeated for every priority.
+const (
+	passIBAN = iota
+	passReciever
+	passConditions
+)
+
+func (m *matcher) matchesPass(pass int, transaction csv.CsvTransaction, captures Captures) bool {
+	switch pass {
+	case passIBAN:
+		return m.iban != "" && m.matchesIBAN(transaction) && m.matchesConditions(transaction, captures)
+	case passReciever:
+		return m.reciever != nil && m.matchesReciever(transaction, captures) && m.matchesConditions(transaction, captures)
+	default:
+		return m.iban == "" && m.reciever == nil && m.matchesConditions(transaction, captures)
+	}
+}
+
+// inPass reports if the rule can match in the given pass at all
+func (m *matcher) inPass(pass int) bool {
+	switch pass {
+	case passIBAN:
+		return m.iban != ""
+	case passReciever:
+		return m.reciever != nil
+	default:
+		return m.iban == "" && m.reciever == nil
+	}
+}
+
+type compiledRule struct {
+	index     int
+	priority  int
+	next      bool
+	data      RuleData
+	match     *matcher
+	templates map[string]*template.Template
+}
+
+// step is a single attempt to match a rule in one of the passes
+type step struct {
+	rule *compiledRule
+	pass int
+}
+
+// RuleSet is the compiled form of the rules of a config. It's immutable and
+// safe to use from multiple goroutines.
+type RuleSet struct {
+	rules []*compiledRule
+	steps []step
+}
+
+// CompileRules validates and compiles the rules. All problems are returned as RuleError.
+func CompileRules(rules []Rule) (*RuleSet, []error) {
+	set := &RuleSet{}
+	errs := []error{}
+	for i, rule := range rules {
+		c := compiler{rule: i}
+		compiled := &compiledRule{
+			index:     i,
+			priority:  rule.Priority,
+			next:      rule.Continue,
+			data:      rule.Data,
+			match:     c.match(rule.Match, "match"),
+			templates: c.templates(rule.Data),
+		}
+		c.splits(rule.Data.Splits)
+		errs = append(errs, c.errs...)
+		// an empty match would match every transaction
+		if !rule.Match.IsEmpty() {
+			set.rules = append(set.rules, compiled)
+		}
+	}
+
+	for pass := passIBAN; pass <= passConditions; pass++ {
+		for _, rule := range set.rules {
+			if rule.match.inPass(pass) {
+				set.steps = append(set.steps, step{rule: rule, pass: pass})
+			}
+		}
+	}
+	// the steps are already ordered by pass and position in the config
+	sort.SliceStable(set.steps, func(i, j int) bool {
+		return set.steps[i].rule.priority > set.steps[j].rule.priority
+	})
+	return set, errs
+}
+
+// MatchResult is the outcome of applying the rule set to a transaction
+type MatchResult struct {
+	// Rule is the index of the first rule which matched, starting at 0
+	Rule int
+	// Rules are the indexes of all rules which were applied in order
+	Rules []int
+	// Data of all applied rules merged together with all templates rendered
+	Data     RuleData
+	Captures Captures
+}
+
+// merge applies the data of a later rule on top of the current data. Fields
+// which are set in the later rule replace the current value, internal is
+// kept once any rule set it and the tags of both rules are combined.
+func (d RuleData) merge(other RuleData) RuleData {
+	tags := append([]string(nil), d.Tags...)
+	for _, tag := range other.Tags {
+		if !contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	// the splits of a later rule replace the earlier ones as a whole
+	splits := d.Splits
+	if len(other.Splits) > 0 {
+		splits = other.Splits
+	}
+	// without tags and splits both rules have the same fields in the same order
+	d.Tags, other.Tags = nil, nil
+	d.Splits, other.Splits = nil, nil
+
+	d.Internal = d.Internal || other.Internal
+	fields := d.textFields()
+	for i, field := range other.textFields() {
+		if *field.value != "" {
+			*fields[i].value = *field.value
+		}
+	}
+	d.Tags = tags
+	d.Splits = splits
+	return d
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Match applies the rules to the transaction. The rules are tried by priority,
+// pass and position in the config. The first matching rule wins, unless it
+// has continue set, then the following rules are tried as well and the data
+// of all matching rules is merged in the order they were applied.
+func (s *RuleSet) Match(transaction csv.CsvTransaction) (MatchResult, bool, error) {
+	result := MatchResult{Captures: Captures{}}
+	applied := make(map[int]bool)
+	for _, step := range s.steps {
+		rule := step.rule
+		if applied[rule.index] {
+			continue
+		}
+
+		captures := Captures{}
+		if !rule.match.matchesPass(step.pass, transaction, captures) {
+			continue
+		}
+
+		data, err := rule.render(TemplateData(transaction, captures))
+		if err != nil {
+			return MatchResult{}, false, RuleError{Rule: rule.index, Err: err}
+		}
+		applied[rule.index] = true
+		result.Rules = append(result.Rules, rule.index)
+		result.Data = result.Data.merge(data)
+		result.Captures.merge(captures)
+
+		if !rule.next {
+			break
+		}
+	}
+
+	if len(result.Rules) == 0 {
+		return MatchResult{}, false, nil
+	}
+	result.Rule = result.Rules[0]
+	return result, true, nil
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fireflysync/internal/csv"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+var templateFuncs = template.FuncMap{
+	"title":    title,
+	"trim":     strings.TrimSpace,
+	"truncate": truncate,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"replace":  replace,
+}
+
+// title upper cases the first letter of every word and lower cases the rest
+func title(value string) string {
+	runes := []rune(strings.ToLower(value))
+	for i, char := range runes {
+		if i == 0 || unicode.IsSpace(runes[i-1]) || runes[i-1] == '-' {
+			runes[i] = unicode.ToUpper(char)
+		}
+	}
+	return string(runes)
+}
+
+// truncate shortens the value to the given number of characters
+func truncate(length int, value string) string {
+	runes := []rune(value)
+	if len(runes) <= length {
+		return value
+	}
+	return string(runes[:length])
+}
+
+func replace(old, new, value string) string {
+	return strings.ReplaceAll(value, old, new)
+}
+
+// TemplateData returns the values which are available in the templates of a rule
+func TemplateData(transaction csv.CsvTransaction, captures Captures) map[string]interface{} {
+	return map[string]interface{}{
+		"match":           captures,
+		"Date":            transaction.Date,
+		"Reciever":        transaction.Reciever,
+		"IBAN":            transaction.IBAN,
+		"TransactionType": transaction.TransactionType,
+		"Reference":       transaction.Reference,
+		"Category":        transaction.Category,
+		"Amount":          transaction.Amount,
+		"Currency":        transaction.Currency,
+		"ForeignAmount":   transaction.ForeignAmount,
+		"ForeignCurrency": transaction.ForeignCurrency,
+	}
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// Render executes the text as template, texts without any action are returned as is
+func Render(text string, data map[string]interface{}) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	if err := tmpl.Execute(&result, data); err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
+
+type textField struct {
+	name  string
+	value *string
+}
+
+// textFields returns all fields of the rule data which are templates
+func (d *RuleData) textFields() []textField {
+	fields := []textField{
+		{"destination", &d.Destination},
+		{"source", &d.Source},
+		{"category", &d.Category},
+		{"description", &d.Description},
+		{"notes", &d.Notes},
+		{"budget", &d.Budget},
+		{"bill", &d.Bill},
+		{"piggy_bank", &d.PiggyBank},
+		{"interest_date", &d.InterestDate},
+		{"book_date", &d.BookDate},
+	}
+	for i := range d.Tags {
+		fields = append(fields, textField{fmt.Sprintf("tags[%d]", i), &d.Tags[i]})
+	}
+	for i := range d.Splits {
+		split := &d.Splits[i]
+		name := fmt.Sprintf("splits[%d].", i)
+		fields = append(fields,
+			textField{name + "destination", &split.Destination},
+			textField{name + "category", &split.Category},
+			textField{name + "budget", &split.Budget},
+			textField{name + "description", &split.Description},
+		)
+	}
+	return fields
+}
+
+// dateFields returns the fields of the rule data which have to contain a date
+func (d *RuleData) dateFields() []textField {
+	return []textField{
+		{"interest_date", &d.InterestDate},
+		{"book_date", &d.BookDate},
+	}
+}
+
+// render returns the data of the rule with all templates executed
+func (r compiledRule) render(data map[string]interface{}) (RuleData, error) {
+	result := r.data
+	// the tags and splits are rendered in place, so they must not share the rule's slices
+	result.Tags = append([]string(nil), r.data.Tags...)
+	result.Splits = append([]Split(nil), r.data.Splits...)
+	for _, field := range result.textFields() {
+		tmpl, ok := r.templates[field.name]
+		if !ok {
+			continue
+		}
+
+		var rendered strings.Builder
+		if err := tmpl.Execute(&rendered, data); err != nil {
+			return result, fmt.Errorf("data.%s: %w", field.name, err)
+		}
+		*field.value = rendered.String()
+	}
+
+	for _, field := range result.dateFields() {
+		if *field.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", *field.value); err != nil {
+			return result, fmt.Errorf("data.%s: %q is not a date like 2006-01-02", field.name, *field.value)
+		}
+	}
+	return result, nil
+}
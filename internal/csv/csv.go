@@ -1,44 +1,210 @@
 package csv
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fireflysync/internal/money"
+	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 	"time"
-
-	"github.com/gocarina/gocsv"
+	"unicode/utf8"
 )
 
 type DateTime struct {
 	time.Time
 }
 
-func (date *DateTime) UnmarshalCSV(csv string) (err error) {
-	date.Time, err = time.Parse("2006-01-02", csv)
-	return err
+func (date DateTime) String() string {
+	return date.Format("2006-01-02")
 }
 
 type CsvTransaction struct {
-	Date            DateTime `csv:"Datum"`
-	Reciever        string   `csv:"Empfänger"`
-	IBAN            string   `csv:"Kontonummer"`
-	TransactionType string   `csv:"Transaktionstyp"`
-	Reference       string   `csv:"Verwendungszweck"`
-	Category        string   `csv:"Kategorie"`
-	Amount          float64  `csv:"Betrag (EUR)"`
-	ForeignAmount   float64  `csv:"Betrag (Fremdwährung)"`
-	ForeignCurrency string   `csv:"Fremdwährung"`
-}
-
-func LoadTransactions(path string) []CsvTransaction {
+	Date            DateTime
+	Reciever        string
+	IBAN            string
+	TransactionType string
+	Reference       string
+	Category        string
+	Amount          money.Amount
+	Currency        string
+	ForeignAmount   money.Amount
+	ForeignCurrency string
+	// Fingerprint identifies the row of the export, see fingerprint
+	Fingerprint string
+}
+
+// FingerprintPrefix is the prefix of all fingerprints, it tells them apart
+// from external IDs set by other tools.
+const FingerprintPrefix = "fireflysync-"
+
+// fingerprint derives a stable ID for the transaction. Rows with identical
+// content are told apart by the number of times they occurred before.
+func (transaction CsvTransaction) fingerprint(occurrence int) string {
+	key := strings.Join([]string{
+		transaction.Date.Format("2006-01-02"),
+		transaction.Amount.String(),
+		transaction.IBAN,
+		transaction.Reference,
+		strconv.Itoa(occurrence),
+	}, "|")
+	hash := sha256.Sum256([]byte(key))
+	return FingerprintPrefix + hex.EncodeToString(hash[:16])
+}
+
+// resolveColumn returns the 0-based position of the column or -1 if the
+// column isn't mapped by the profile or isn't part of the file.
+func resolveColumn(column Column, header []string) int {
+	if column.Index > 0 && column.Index <= len(header) {
+		return column.Index - 1
+	}
+
+	for i, name := range header {
+		if column.Name != "" && strings.TrimSpace(name) == column.Name {
+			return i
+		}
+	}
+	return -1
+}
+
+func newReader(file io.Reader, profile Profile) (*csv.Reader, error) {
+	buffered := bufio.NewReader(file)
+	for i := 0; i < profile.SkipLines; i++ {
+		if _, err := buffered.ReadString('\n'); err != nil {
+			return nil, err
+		}
+	}
+
+	reader := csv.NewReader(buffered)
+	reader.FieldsPerRecord = -1
+	if profile.Delimiter != "" {
+		delimiter, _ := utf8.DecodeRuneInString(profile.Delimiter)
+		reader.Comma = delimiter
+	}
+	return reader, nil
+}
+
+func ReadTransactions(file io.Reader, profile Profile) ([]CsvTransaction, error) {
+	reader, err := newReader(file, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	columns := map[string]Column{
+		"date":             profile.Columns.Date,
+		"reciever":         profile.Columns.Reciever,
+		"iban":             profile.Columns.IBAN,
+		"transaction_type": profile.Columns.TransactionType,
+		"reference":        profile.Columns.Reference,
+		"category":         profile.Columns.Category,
+		"amount":           profile.Columns.Amount,
+		"debit":            profile.Columns.Debit,
+		"credit":           profile.Columns.Credit,
+		"currency":         profile.Columns.Currency,
+		"foreign_amount":   profile.Columns.ForeignAmount,
+		"foreign_currency": profile.Columns.ForeignCurrency,
+	}
+	positions := make(map[string]int, len(columns))
+	for field, column := range columns {
+		positions[field] = resolveColumn(column, header)
+	}
+
+	// all other columns are optional, just like the exports of some banks
+	if positions["date"] < 0 {
+		return nil, fmt.Errorf("date column %s not found", profile.Columns.Date)
+	}
+	if positions["amount"] < 0 && positions["debit"] < 0 && positions["credit"] < 0 {
+		return nil, fmt.Errorf("amount column %s not found", profile.Columns.Amount)
+	}
+
 	transactions := []CsvTransaction{}
-	csvFile, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, os.ModePerm)
+	occurrences := map[string]int{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		line += profile.SkipLines
+		value := func(field string) string {
+			position := positions[field]
+			if position < 0 || position >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[position])
+		}
+
+		var transaction CsvTransaction
+		if transaction.Date, err = parseDate(value("date"), profile.dateFormats()); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if transaction.Amount, err = parseAmount(value("amount"), profile); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		// debit and credit columns usually both contain positive numbers,
+		// only the column tells in which direction the money went
+		debit, err := parseAmount(value("debit"), profile)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		credit, err := parseAmount(value("credit"), profile)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		transaction.Amount = transaction.Amount.Add(credit.Abs()).Sub(debit.Abs())
+		if transaction.ForeignAmount, err = parseAmount(value("foreign_amount"), profile); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		// a currency column overrides the currency of the profile for the row
+		transaction.Currency = profile.Currency
+		if currency := value("currency"); currency != "" {
+			transaction.Currency = strings.ToUpper(currency)
+		}
+		transaction.Reciever = value("reciever")
+		transaction.IBAN = value("iban")
+		transaction.TransactionType = value("transaction_type")
+		transaction.Reference = value("reference")
+		transaction.Category = value("category")
+		transaction.ForeignCurrency = value("foreign_currency")
+
+		key := transaction.fingerprint(0)
+		transaction.Fingerprint = transaction.fingerprint(occurrences[key])
+		occurrences[key]++
+
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, nil
+}
+
+// ReadFile reads the transactions of the CSV file at the given path
+func ReadFile(path string, profile Profile) ([]CsvTransaction, error) {
+	csvFile, err := os.Open(path)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer csvFile.Close()
 
-	if err := gocsv.UnmarshalFile(csvFile, &transactions); err != nil {
-		panic(err)
+	transactions, err := ReadTransactions(csvFile, profile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
 
-	return transactions
+	return transactions, nil
 }
@@ -0,0 +1,84 @@
+package csv
+
+import (
+	"fireflysync/internal/money"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+func parseDate(value string, layouts []string) (DateTime, error) {
+	for _, layout := range layouts {
+		date, err := time.Parse(layout, value)
+		if err == nil {
+			return DateTime{date}, nil
+		}
+	}
+	return DateTime{}, fmt.Errorf("date %q doesn't match any of the formats %q", value, layouts)
+}
+
+// normalizeAmount converts a localized amount like "1.234,56 €" or "12,00-"
+// into the canonical form "-1234.56". Empty values are returned as is.
+// Currency symbols and codes are only allowed before or after the number.
+func normalizeAmount(value string, profile Profile) (string, error) {
+	var normalized strings.Builder
+	negative := false
+	// suffix is set once a letter or symbol follows the number, it has to be the end of it
+	suffix := false
+
+	rest := value
+	for len(rest) > 0 {
+		switch {
+		case profile.ThousandsSeparator != "" && strings.HasPrefix(rest, profile.ThousandsSeparator):
+			if suffix {
+				return "", fmt.Errorf("invalid amount %q", value)
+			}
+			rest = rest[len(profile.ThousandsSeparator):]
+			continue
+		case strings.HasPrefix(rest, profile.decimalSeparator()):
+			if suffix {
+				return "", fmt.Errorf("invalid amount %q", value)
+			}
+			normalized.WriteByte('.')
+			rest = rest[len(profile.decimalSeparator()):]
+			continue
+		}
+
+		char := []rune(rest)[0]
+		rest = rest[len(string(char)):]
+		switch {
+		case char >= '0' && char <= '9' && !suffix:
+			normalized.WriteRune(char)
+		case char == '-' || char == '−':
+			negative = !negative
+		case char == '+' || unicode.IsSpace(char):
+			// signs and whitespace carry no value
+		case unicode.IsLetter(char) || unicode.Is(unicode.Sc, char):
+			// currency symbols or codes carry no value either
+			suffix = normalized.Len() > 0
+		default:
+			return "", fmt.Errorf("invalid amount %q", value)
+		}
+	}
+
+	if normalized.Len() == 0 {
+		if strings.TrimSpace(value) != "" {
+			return "", fmt.Errorf("invalid amount %q", value)
+		}
+		return "", nil
+	}
+
+	if negative {
+		return "-" + normalized.String(), nil
+	}
+	return normalized.String(), nil
+}
+
+func parseAmount(value string, profile Profile) (money.Amount, error) {
+	normalized, err := normalizeAmount(value, profile)
+	if err != nil || normalized == "" {
+		return money.Amount{}, err
+	}
+	return money.Parse(normalized)
+}
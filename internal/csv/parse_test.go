@@ -0,0 +1,207 @@
+package csv
+
+import (
+	"fireflysync/internal/money"
+	"strings"
+	"testing"
+	"time"
+)
+
+var germanProfile = Profile{DecimalSeparator: ",", ThousandsSeparator: "."}
+
+func TestNormalizeAmount(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		profile Profile
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", value: "12.34", want: "12.34"},
+		{name: "negative", value: "-12.34", want: "-12.34"},
+		{name: "explicit plus", value: "+5", want: "5"},
+		{name: "thousands and decimal separator", value: "-1.234,56", profile: germanProfile, want: "-1234.56"},
+		{name: "english thousands separator", value: "1,234.56", profile: Profile{ThousandsSeparator: ","}, want: "1234.56"},
+		{name: "trailing minus", value: "12,00-", profile: germanProfile, want: "-12.00"},
+		{name: "unicode minus", value: "−3,50", profile: germanProfile, want: "-3.50"},
+		{name: "euro symbol", value: "1.234,56 €", profile: germanProfile, want: "1234.56"},
+		{name: "dollar symbol", value: "$12.00", want: "12.00"},
+		{name: "currency code", value: "EUR -7,10", profile: germanProfile, want: "-7.10"},
+		{name: "currency code after the number", value: "12,00 EUR-", profile: germanProfile, want: "-12.00"},
+		{name: "surrounding spaces", value: "  4,20  ", profile: germanProfile, want: "4.20"},
+		{name: "empty", value: "", want: ""},
+		{name: "only spaces", value: "   ", want: ""},
+		{name: "only a currency", value: "€", wantErr: true},
+		{name: "invalid character", value: "12#34", wantErr: true},
+		{name: "parentheses", value: "(12.00)", wantErr: true},
+		{name: "letter between digits", value: "12O,00", profile: germanProfile, wantErr: true},
+		{name: "exponent", value: "1e3", wantErr: true},
+		{name: "symbol between digits", value: "12€50", wantErr: true},
+		{name: "number after a currency code", value: "12 EUR 5", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := normalizeAmount(test.value, test.profile)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("normalizeAmount(%q) = %q, want an error", test.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeAmount(%q) failed: %v", test.value, err)
+			}
+			if got != test.want {
+				t.Errorf("normalizeAmount(%q) = %q, want %q", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		profile Profile
+		want    string
+		wantErr bool
+	}{
+		{name: "german", value: "-1.234,56", profile: germanProfile, want: "-1234.56"},
+		{name: "trailing minus", value: "12,00-", profile: germanProfile, want: "-12"},
+		{name: "currency symbol", value: "99,99 €", profile: germanProfile, want: "99.99"},
+		{name: "empty is zero", value: "", want: "0"},
+		{name: "two decimal separators", value: "1,2,3", profile: germanProfile, wantErr: true},
+		{name: "invalid", value: "abc!", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseAmount(test.value, test.profile)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("parseAmount(%q) = %s, want an error", test.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAmount(%q) failed: %v", test.value, err)
+			}
+			if want := money.MustParse(test.want); !got.Equal(want) {
+				t.Errorf("parseAmount(%q) = %s, want %s", test.value, got, want)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	german := []string{"02.01.2006", "02.01.06"}
+	tests := []struct {
+		name    string
+		value   string
+		layouts []string
+		want    string
+		wantErr bool
+	}{
+		{name: "default layout", value: "2026-10-18", layouts: Profile{}.dateFormats(), want: "2026-10-18"},
+		{name: "first layout", value: "18.10.2026", layouts: german, want: "2026-10-18"},
+		{name: "fallback layout", value: "18.10.26", layouts: german, want: "2026-10-18"},
+		{name: "no layout matches", value: "10/18/2026", layouts: german, wantErr: true},
+		{name: "invalid day", value: "32.10.2026", layouts: german, wantErr: true},
+		{name: "empty", value: "", layouts: german, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseDate(test.value, test.layouts)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("parseDate(%q) = %s, want an error", test.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDate(%q) failed: %v", test.value, err)
+			}
+			want, _ := time.Parse("2006-01-02", test.want)
+			if !got.Equal(want) {
+				t.Errorf("parseDate(%q) = %s, want %s", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadTransactionsDebitCredit(t *testing.T) {
+	profile := Profile{
+		Delimiter:          ";",
+		DecimalSeparator:   ",",
+		ThousandsSeparator: ".",
+		DateFormats:        []string{"02.01.2006"},
+		Columns: Columns{
+			Date:   Column{Name: "Datum"},
+			Debit:  Column{Name: "Soll"},
+			Credit: Column{Name: "Haben"},
+		},
+	}
+	tests := []struct {
+		name   string
+		debit  string
+		credit string
+		want   string
+	}{
+		{name: "debit", debit: "1.234,56", want: "-1234.56"},
+		{name: "credit", credit: "50,00", want: "50"},
+		{name: "negative debit", debit: "-12,00", want: "-12"},
+		{name: "debit and credit", debit: "10,00", credit: "2,50", want: "-7.50"},
+		{name: "neither", want: "0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := "Datum;Soll;Haben\n18.10.2026;" + test.debit + ";" + test.credit + "\n"
+			transactions, err := ReadTransactions(strings.NewReader(file), profile)
+			if err != nil {
+				t.Fatalf("ReadTransactions failed: %v", err)
+			}
+			if len(transactions) != 1 {
+				t.Fatalf("got %d transactions, want 1", len(transactions))
+			}
+			if want := money.MustParse(test.want); !transactions[0].Amount.Equal(want) {
+				t.Errorf("amount = %s, want %s", transactions[0].Amount, want)
+			}
+		})
+	}
+}
+
+func TestReadTransactionsCurrency(t *testing.T) {
+	profile := Profile{
+		Currency: "EUR",
+		Columns: Columns{
+			Date:     Column{Name: "date"},
+			Amount:   Column{Name: "amount"},
+			Currency: Column{Name: "currency"},
+		},
+	}
+	tests := []struct {
+		name     string
+		currency string
+		want     string
+	}{
+		{name: "column", currency: "JPY", want: "JPY"},
+		{name: "lower case", currency: "usd", want: "USD"},
+		{name: "empty uses the profile", currency: "", want: "EUR"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := "date,amount,currency\n2026-10-18,-12," + test.currency + "\n"
+			transactions, err := ReadTransactions(strings.NewReader(file), profile)
+			if err != nil {
+				t.Fatalf("ReadTransactions failed: %v", err)
+			}
+			if transactions[0].Currency != test.want {
+				t.Errorf("currency = %q, want %q", transactions[0].Currency, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package csv
+
+import "strconv"
+
+// Column references a column of the CSV file either by its header name or by
+// its position. Positions start at 1, so the zero value means "not mapped".
+type Column struct {
+	Name  string
+	Index int
+}
+
+func (column *Column) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&column.Index); err == nil {
+		return nil
+	}
+	return unmarshal(&column.Name)
+}
+
+func (column Column) String() string {
+	if column.Index > 0 {
+		return strconv.Itoa(column.Index)
+	}
+	return strconv.Quote(column.Name)
+}
+
+// Columns maps the logical fields of a transaction to the columns of a bank export
+type Columns struct {
+	Date            Column `yaml:"date"`
+	Reciever        Column `yaml:"reciever"`
+	IBAN            Column `yaml:"iban"`
+	TransactionType Column `yaml:"transaction_type"`
+	Reference       Column `yaml:"reference"`
+	Category        Column `yaml:"category"`
+	Amount          Column `yaml:"amount"`
+	Debit           Column `yaml:"debit"`
+	Credit          Column `yaml:"credit"`
+	Currency        Column `yaml:"currency"`
+	ForeignAmount   Column `yaml:"foreign_amount"`
+	ForeignCurrency Column `yaml:"foreign_currency"`
+}
+
+// Profile describes the layout of a CSV export of one specific bank
+type Profile struct {
+	Delimiter          string   `yaml:"delimiter"`
+	SkipLines          int      `yaml:"skip_lines"`
+	Currency           string   `yaml:"currency"`
+	DateFormats        []string `yaml:"date_formats"`
+	DecimalSeparator   string   `yaml:"decimal_separator"`
+	ThousandsSeparator string   `yaml:"thousands_separator"`
+	Columns            Columns  `yaml:"columns"`
+}
+
+func (profile Profile) dateFormats() []string {
+	if len(profile.DateFormats) == 0 {
+		return []string{"2006-01-02"}
+	}
+	return profile.DateFormats
+}
+
+func (profile Profile) decimalSeparator() string {
+	if profile.DecimalSeparator == "" {
+		return "."
+	}
+	return profile.DecimalSeparator
+}
+
+// DefaultProfile is used when the config doesn't define any profiles
+var DefaultProfile = Profile{
+	Delimiter: ",",
+	Columns: Columns{
+		Date:            Column{Name: "Datum"},
+		Reciever:        Column{Name: "Empfänger"},
+		IBAN:            Column{Name: "Kontonummer"},
+		TransactionType: Column{Name: "Transaktionstyp"},
+		Reference:       Column{Name: "Verwendungszweck"},
+		Category:        Column{Name: "Kategorie"},
+		Amount:          Column{Name: "Betrag (EUR)"},
+		ForeignAmount:   Column{Name: "Betrag (Fremdwährung)"},
+		ForeignCurrency: Column{Name: "Fremdwährung"},
+	},
+}
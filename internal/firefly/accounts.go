@@ -0,0 +1,381 @@
+package firefly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type FireflyAccount struct {
+	Type       string `json:"type"`
+	ID         string `json:"id"`
+	Attributes struct {
+		Name          string `json:"name"`
+		Type          string `json:"type"`
+		Active        bool   `json:"active"`
+		IBAN          string `json:"iban"`
+		AccountNumber string `json:"account_number"`
+		CurrencyCode  string `json:"currency_code"`
+		AccountRole   string `json:"account_role"`
+	} `json:"attributes"`
+}
+
+type FireflyAccountListResponse struct {
+	Data []FireflyAccount `json:"data"`
+	FireflyPagination
+}
+
+// ListAccounts returns all accounts of the given type, e.g. "asset" or
+// "expense". An empty type returns all accounts.
+func (c *Client) ListAccounts(accountType string) ([]FireflyAccount, error) {
+	params := url.Values{}
+	if accountType != "" {
+		params.Add("type", accountType)
+	}
+
+	accounts := []FireflyAccount{}
+	err := c.getPages(fmt.Sprintf("%s/api/v1/accounts", c.URL), params, func(body []byte) (FireflyPagination, error) {
+		var data FireflyAccountListResponse
+		if err := json.Unmarshal(body, &data); err != nil {
+			return FireflyPagination{}, err
+		}
+		accounts = append(accounts, data.Data...)
+		return data.FireflyPagination, nil
+	})
+	return accounts, err
+}
+
+// accounts returns all accounts of Firefly III, they are only loaded once
+func (c *Client) accounts() ([]FireflyAccount, error) {
+	c.mutex.Lock()
+	accounts := c.accountCache
+	c.mutex.Unlock()
+	if accounts != nil {
+		return accounts, nil
+	}
+
+	accounts, err := c.ListAccounts("")
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.accountCache == nil {
+		c.accountCache = accounts
+	}
+	return c.accountCache, nil
+}
+
+// ownAccountTypes are the types of the accounts which belong to the user
+var ownAccountTypes = []string{"asset", "liabilities", "liability"}
+
+// counterpartyTypes returns the account types which can be on the other side
+// of a transaction of the given type
+func counterpartyTypes(transactionType string) []string {
+	switch transactionType {
+	case "withdrawal":
+		return []string{"expense", "liabilities", "liability"}
+	case "deposit":
+		return []string{"revenue", "liabilities", "liability"}
+	}
+	return ownAccountTypes
+}
+
+func hasType(account FireflyAccount, types []string) bool {
+	for _, accountType := range types {
+		if strings.EqualFold(account.Attributes.Type, accountType) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+}
+
+// levenshtein returns the number of edits which turn one text into the other
+func levenshtein(a, b string) int {
+	x, y := []rune(strings.ToLower(a)), []rune(strings.ToLower(b))
+	previous := make([]int, len(y)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(x); i++ {
+		current := make([]int, len(y)+1)
+		current[0] = i
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+			current[j] = current[j-1] + 1
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if previous[j-1]+cost < current[j] {
+				current[j] = previous[j-1] + cost
+			}
+		}
+		previous = current
+	}
+	return previous[len(y)]
+}
+
+// closestAccount returns the name of the account which is most similar to
+// the name, or an empty string if none of them is similar enough.
+func closestAccount(accounts []FireflyAccount, name string, types []string) string {
+	best, distance := "", len([]rune(name))/3+1
+	for _, account := range accounts {
+		if !hasType(account, types) {
+			continue
+		}
+		if d := levenshtein(account.Attributes.Name, name); d < distance {
+			best, distance = account.Attributes.Name, d
+		}
+	}
+	return best
+}
+
+// findAccount returns the account with the IBAN or, if there is none, the
+// account with the name. It fails if an account with the name doesn't exist.
+func (c *Client) findAccount(name, iban string, types []string) (*FireflyAccount, error) {
+	accounts, err := c.accounts()
+	if err != nil {
+		return nil, err
+	}
+
+	if iban != "" {
+		for i, account := range accounts {
+			if hasType(account, types) && normalizeIBAN(account.Attributes.IBAN) == normalizeIBAN(iban) {
+				return &accounts[i], nil
+			}
+		}
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	var similar *FireflyAccount
+	for i, account := range accounts {
+		if !hasType(account, types) {
+			continue
+		}
+		if account.Attributes.Name == name {
+			return &accounts[i], nil
+		}
+		if similar == nil && strings.EqualFold(account.Attributes.Name, name) {
+			similar = &accounts[i]
+		}
+	}
+	if similar != nil {
+		return similar, nil
+	}
+
+	if suggestion := closestAccount(accounts, name, types); suggestion != "" {
+		return nil, fmt.Errorf("account %q doesn't exist in Firefly III, did you mean %q?", name, suggestion)
+	}
+	return nil, fmt.Errorf("account %q doesn't exist in Firefly III", name)
+}
+
+// resolveAccount sets the ID and the exact name of the account of one side of a transaction
+func (c *Client) resolveAccount(side string, name, id *string, iban string, types []string) error {
+	account, err := c.findAccount(*name, iban, types)
+	if err != nil {
+		return fmt.Errorf("%s: %w", side, err)
+	}
+	if account != nil {
+		*name = account.Attributes.Name
+		*id = account.ID
+	}
+	return nil
+}
+
+// resolveAccounts looks up the accounts of a single transaction, iban is the
+// IBAN of the counterparty.
+func (c *Client) resolveAccounts(transaction *FireflyTransaction, iban string) error {
+	source := ownAccountTypes
+	destination := counterpartyTypes(transaction.Type)
+	sourceIBAN, destinationIBAN := "", iban
+	// the direction of a transfer between own accounts isn't known anymore and
+	// one IBAN can belong to several payees, e.g. PayPal, which rules tell apart
+	if transaction.Type == "transfer" || transaction.CounterpartyByRule {
+		destinationIBAN = ""
+	}
+	if transaction.Type == "deposit" {
+		source, destination = destination, source
+		sourceIBAN, destinationIBAN = destinationIBAN, sourceIBAN
+	}
+
+	if err := c.resolveAccount("source", &transaction.Source, &transaction.SourceID, sourceIBAN, source); err != nil {
+		return err
+	}
+	return c.resolveAccount("destination", &transaction.Destination, &transaction.DestinationID, destinationIBAN, destination)
+}
+
+// ResolveAccounts looks up the source and destination of the transaction and
+// its splits in Firefly III and sets their IDs. The counterparty is found by
+// its IBAN first unless a rule set it, and then by name. Accounts which don't exist are an error, so that
+// a typo in a rule doesn't create a new account.
+func (c *Client) ResolveAccounts(transaction *FireflyTransaction, iban string) error {
+	source, destination := transaction.Source, transaction.Destination
+	if err := c.resolveAccounts(transaction, iban); err != nil {
+		return err
+	}
+
+	for i := range transaction.Splits {
+		split := &transaction.Splits[i]
+		// splits which don't change the accounts use the same IBAN
+		splitIBAN := ""
+		if split.Source == source && split.Destination == destination {
+			splitIBAN = iban
+		}
+		if err := c.resolveAccounts(split, splitIBAN); err != nil {
+			return fmt.Errorf("split %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+type FireflyAccountRequest struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	IBAN string `json:"iban,omitempty"`
+}
+
+type FireflyAccountCreateResponse struct {
+	Data FireflyAccount `json:"data"`
+}
+
+// createAccount creates the account and returns its ID
+func (c *Client) createAccount(account FireflyAccount) (string, error) {
+	data, _ := json.Marshal(FireflyAccountRequest{Name: account.Attributes.Name, Type: account.Attributes.Type, IBAN: account.Attributes.IBAN})
+	requestUrl := fmt.Sprintf("%s/api/v1/accounts", c.URL)
+	req, err := http.NewRequest(http.MethodPost, requestUrl, bytes.NewBuffer(data))
+	if err != nil {
+		return "", err
+	}
+
+	res, err := c.sendRequest(req)
+	if err != nil {
+		return "", err
+	}
+	body, err := readResponse(res, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+
+	var response FireflyAccountCreateResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("decode response of %s: %w", req.URL.Path, err)
+	}
+	if response.Data.ID == "" {
+		return "", fmt.Errorf("response of %s doesn't contain an ID", req.URL.Path)
+	}
+	return response.Data.ID, nil
+}
+
+// counterparty returns the name and the ID of the counterparty of the
+// transaction and the types its account can have
+func counterparty(transaction *FireflyTransaction) (*string, *string, []string) {
+	if transaction.Type == "deposit" {
+		return &transaction.Source, &transaction.SourceID, counterpartyTypes(transaction.Type)
+	}
+	return &transaction.Destination, &transaction.DestinationID, counterpartyTypes(transaction.Type)
+}
+
+// PlanCounterparty makes sure that an expense or revenue account with the
+// IBAN exists for a transaction which didn't match any rule and uses it as
+// counterparty. If there is none, an account named after the reciever is
+// planned: it's known without an ID from now on, so that the accounts can be
+// resolved, but it's only created by CreatePlannedAccount once a transaction
+// which uses it is pushed.
+func (c *Client) PlanCounterparty(transaction *FireflyTransaction, reciever, iban string) error {
+	reciever = strings.TrimSpace(reciever)
+	if transaction.RuleMatch || iban == "" || reciever == "" || transaction.Type == "transfer" {
+		return nil
+	}
+	name, _, types := counterparty(transaction)
+
+	accounts, err := c.accounts()
+	if err != nil {
+		return err
+	}
+	var existing *FireflyAccount
+	for i, account := range accounts {
+		if !hasType(account, types) {
+			continue
+		}
+		if normalizeIBAN(account.Attributes.IBAN) == normalizeIBAN(iban) {
+			// the account is found by its IBAN when the accounts are resolved
+			return nil
+		}
+		// Firefly III doesn't allow two accounts of the same type with the same name
+		if existing == nil && strings.EqualFold(account.Attributes.Name, reciever) {
+			existing = &accounts[i]
+		}
+	}
+	if existing != nil {
+		*name = existing.Attributes.Name
+		return nil
+	}
+
+	account := FireflyAccount{}
+	account.Attributes.Name = reciever
+	account.Attributes.Type = types[0]
+	account.Attributes.IBAN = iban
+	account.Attributes.Active = true
+	c.mutex.Lock()
+	c.accountCache = append(c.accountCache, account)
+	c.planned[len(c.accountCache)-1] = true
+	c.mutex.Unlock()
+	*name = reciever
+	return nil
+}
+
+// CreatePlannedAccount creates the account of the counterparty of the
+// transaction if it was planned by PlanCounterparty and not created yet, and
+// sets its ID. It returns the name of the account if it was created, on a
+// dry run the account isn't created but its name is still returned once.
+func (c *Client) CreatePlannedAccount(transaction *FireflyTransaction, dryRun bool) (string, error) {
+	name, id, types := counterparty(transaction)
+	if transaction.Type == "transfer" || *id != "" || *name == "" {
+		return "", nil
+	}
+
+	c.mutex.Lock()
+	index := -1
+	for i, account := range c.accountCache {
+		if account.Attributes.Name != *name || !hasType(account, types) {
+			continue
+		}
+		if c.planned[i] {
+			index = i
+			delete(c.planned, i)
+			break
+		}
+		// the account was already created for an earlier transaction
+		*id = account.ID
+	}
+	var account FireflyAccount
+	if index >= 0 {
+		account = c.accountCache[index]
+	}
+	c.mutex.Unlock()
+	if index < 0 || dryRun {
+		return account.Attributes.Name, nil
+	}
+
+	accountID, err := c.createAccount(account)
+	if err != nil {
+		return "", fmt.Errorf("create %s account %q: %w", account.Attributes.Type, *name, err)
+	}
+	c.mutex.Lock()
+	c.accountCache[index].ID = accountID
+	c.mutex.Unlock()
+	*id = accountID
+	return *name, nil
+}
@@ -0,0 +1,34 @@
+package firefly
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type FireflyCategory struct {
+	Type       string `json:"type"`
+	ID         string `json:"id"`
+	Attributes struct {
+		Name  string `json:"name"`
+		Notes string `json:"notes"`
+	} `json:"attributes"`
+}
+
+type FireflyCategoryListResponse struct {
+	Data []FireflyCategory `json:"data"`
+	FireflyPagination
+}
+
+// ListCategories returns all categories
+func (c *Client) ListCategories() ([]FireflyCategory, error) {
+	categories := []FireflyCategory{}
+	err := c.getPages(fmt.Sprintf("%s/api/v1/categories", c.URL), nil, func(body []byte) (FireflyPagination, error) {
+		var data FireflyCategoryListResponse
+		if err := json.Unmarshal(body, &data); err != nil {
+			return FireflyPagination{}, err
+		}
+		categories = append(categories, data.Data...)
+		return data.FireflyPagination, nil
+	})
+	return categories, err
+}
@@ -0,0 +1,364 @@
+package firefly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fireflysync/internal/csv"
+	"fireflysync/internal/money"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client talks to the API of Firefly III. It's safe for concurrent use,
+// the caches and MatchedTransactionIDs are guarded by a mutex.
+type Client struct {
+	URL        string
+	Token      string
+	HTTPClient *http.Client
+	// MatchedTransactionIDs are the transaction groups which were found as
+	// duplicate or created, so they aren't matched again
+	MatchedTransactionIDs map[int]bool
+	// DuplicateWindow is the number of days before and after the date of a
+	// transaction which are searched for duplicates
+	DuplicateWindow int
+	// Fingerprints are the external IDs of all rows of the imported file,
+	// transactions which were imported with another fingerprint are compared
+	// like transactions without an external ID
+	Fingerprints map[string]bool
+	// Retries is the number of times a request is repeated after a transient
+	// error, Backoff is the wait before the first retry which doubles with
+	// every retry up to MaxBackoff
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// mutex guards MatchedTransactionIDs and the caches
+	mutex sync.Mutex
+	// transactions caches the existing transactions by day
+	transactions map[string][]FireflyTransactionGroup
+	// externalIDs caches the IDs of the transaction groups by external ID
+	externalIDs map[string][]int
+	// accountCache holds all accounts once they were loaded
+	accountCache []FireflyAccount
+	// planned are the indexes of the accounts in accountCache which are
+	// only planned and not created yet
+	planned map[int]bool
+	// limiter limits the number of requests per second if it's set
+	limiter *rateLimiter
+}
+
+func NewClient(url, token string) *Client {
+	return &Client{
+		URL:   url,
+		Token: token,
+		HTTPClient: &http.Client{
+			Timeout: time.Minute,
+		},
+		Retries:               DefaultRetries,
+		Backoff:               DefaultBackoff,
+		MaxBackoff:            DefaultMaxBackoff,
+		MatchedTransactionIDs: make(map[int]bool),
+		transactions:          make(map[string][]FireflyTransactionGroup),
+		externalIDs:           make(map[string][]int),
+		planned:               make(map[int]bool),
+	}
+}
+
+func (c *Client) sendRequest(req *http.Request) (*http.Response, error) {
+	req.Header.Add("Authorization", "Bearer "+c.Token)
+	req.Header.Add("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Add("Accept", "application/vnd.api+json")
+	return c.do(req)
+}
+
+// getPages requests the given URL and follows the pagination until all pages are read
+func (c *Client) getPages(requestUrl string, params url.Values, page func(body []byte) (FireflyPagination, error)) error {
+	if len(params) > 0 {
+		requestUrl += "?" + params.Encode()
+	}
+
+	for requestUrl != "" {
+		req, err := http.NewRequest(http.MethodGet, requestUrl, nil)
+		if err != nil {
+			return err
+		}
+
+		res, err := c.sendRequest(req)
+		if err != nil {
+			return err
+		}
+		body, err := readResponse(res, http.StatusOK)
+		if err != nil {
+			return err
+		}
+
+		pagination, err := page(body)
+		if err != nil {
+			return err
+		}
+
+		requestUrl = pagination.Links.Next
+		meta := pagination.Meta.Pagination
+		if requestUrl == "" && meta.CurrentPage < meta.TotalPages {
+			next, err := url.Parse(req.URL.String())
+			if err != nil {
+				return err
+			}
+			query := next.Query()
+			query.Set("page", strconv.Itoa(meta.CurrentPage+1))
+			next.RawQuery = query.Encode()
+			requestUrl = next.String()
+		}
+	}
+
+	return nil
+}
+
+// ListTransactions returns all transaction groups between start and end, both inclusive
+func (c *Client) ListTransactions(start, end time.Time) ([]FireflyTransactionGroup, error) {
+	params := url.Values{}
+	params.Add("start", start.Format("2006-01-02"))
+	params.Add("end", end.Format("2006-01-02"))
+
+	groups := []FireflyTransactionGroup{}
+	err := c.getPages(fmt.Sprintf("%s/api/v1/transactions", c.URL), params, func(body []byte) (FireflyPagination, error) {
+		var data FireflyTransactionSearchResponse
+		if err := json.Unmarshal(body, &data); err != nil {
+			return FireflyPagination{}, err
+		}
+		groups = append(groups, data.Data...)
+		return data.FireflyPagination, nil
+	})
+	return groups, err
+}
+
+// fetchTransactions loads all transactions between start and end into the cache
+func (c *Client) fetchTransactions(start, end time.Time) error {
+	groups, err := c.ListTransactions(start, end)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		c.transactions[day.Format("2006-01-02")] = []FireflyTransactionGroup{}
+	}
+	for _, group := range groups {
+		if len(group.Attributes.Transactions) == 0 {
+			continue
+		}
+		day := group.Attributes.Transactions[0].Date.Format("2006-01-02")
+		c.transactions[day] = append(c.transactions[day], group)
+	}
+
+	return nil
+}
+
+// window returns the first and last day which are searched for duplicates of
+// a transaction on the given date
+func (c *Client) window(date time.Time) (time.Time, time.Time) {
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	return date.AddDate(0, 0, -c.DuplicateWindow), date.AddDate(0, 0, c.DuplicateWindow)
+}
+
+// missingDays returns the part of the range which isn't cached yet, ok is
+// false if all days are cached
+func (c *Client) missingDays(start, end time.Time) (missingStart, missingEnd time.Time, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		if _, ok := c.transactions[day.Format("2006-01-02")]; ok {
+			continue
+		}
+		if missingStart.IsZero() {
+			missingStart = day
+		}
+		missingEnd = day
+	}
+	return missingStart, missingEnd, !missingStart.IsZero()
+}
+
+// transactionsOn returns the existing transactions of the given day, sorted
+// by their distance to the day within the duplicate window.
+func (c *Client) transactionsOn(date time.Time) ([]FireflyTransactionGroup, error) {
+	start, end := c.window(date)
+
+	// only fetch the part of the window which isn't cached yet
+	if missingStart, missingEnd, ok := c.missingDays(start, end); ok {
+		if err := c.fetchTransactions(missingStart, missingEnd); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	groups := append([]FireflyTransactionGroup{}, c.transactions[date.Format("2006-01-02")]...)
+	for offset := 1; offset <= c.DuplicateWindow; offset++ {
+		groups = append(groups, c.transactions[date.AddDate(0, 0, -offset).Format("2006-01-02")]...)
+		groups = append(groups, c.transactions[date.AddDate(0, 0, offset).Format("2006-01-02")]...)
+	}
+	return groups, nil
+}
+
+// searchExternalID returns the IDs of all transaction groups with the given external ID
+func (c *Client) searchExternalID(externalID string) ([]int, error) {
+	params := url.Values{}
+	params.Add("query", fmt.Sprintf("external_id_is:\"%s\"", externalID))
+
+	ids := []int{}
+	err := c.getPages(fmt.Sprintf("%s/api/v1/search/transactions", c.URL), params, func(body []byte) (FireflyPagination, error) {
+		var data FireflyTransactionSearchResponse
+		if err := json.Unmarshal(body, &data); err != nil {
+			return FireflyPagination{}, err
+		}
+		for _, group := range data.Data {
+			id, err := strconv.Atoi(group.ID)
+			if err != nil {
+				return FireflyPagination{}, err
+			}
+			ids = append(ids, id)
+		}
+		return data.FireflyPagination, nil
+	})
+	return ids, err
+}
+
+// claim marks the transaction group as matched, it returns false if it was
+// already matched before
+func (c *Client) claim(id int) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.MatchedTransactionIDs[id] {
+		return false
+	}
+	c.MatchedTransactionIDs[id] = true
+	return true
+}
+
+// searchedExternalID returns the IDs of the transaction groups with the
+// external ID which were found by SearchExternalIDs
+func (c *Client) searchedExternalID(externalID string) []int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.externalIDs[externalID]
+}
+
+// Returns with a Firefly Transaction ID if it found a matching transaction.
+// Transactions are looked up by their external ID first and only if that
+// fails the source, destination and amount are compared. Transactions which
+// were moved to another date are only found if SearchExternalIDs searched
+// them before.
+func (c *Client) GetTransaction(transaction FireflyTransaction) (int, error) {
+	groups, err := c.transactionsOn(transaction.Date.Time)
+	if err != nil {
+		return -1, err
+	}
+
+	if transaction.ExternalID != "" {
+		for _, ffTransactions := range groups {
+			for _, ffTransaction := range ffTransactions.Attributes.Transactions {
+				id, _ := strconv.Atoi(ffTransactions.ID)
+				if ffTransaction.ExternalID == transaction.ExternalID && c.claim(id) {
+					return id, nil
+				}
+			}
+		}
+
+		// the transaction might have been moved to another date in Firefly
+		for _, id := range c.searchedExternalID(transaction.ExternalID) {
+			if c.claim(id) {
+				return id, nil
+			}
+		}
+	}
+
+	amount, err := money.Parse(transaction.Amount)
+	if err != nil {
+		return -1, err
+	}
+
+	for _, ffTransactions := range groups {
+		for _, ffTransaction := range ffTransactions.Attributes.Transactions {
+			// transactions imported by this tool belong to another row of the export,
+			// unless the fingerprint of the row changed since
+			if strings.HasPrefix(ffTransaction.ExternalID, csv.FingerprintPrefix) && c.Fingerprints[ffTransaction.ExternalID] {
+				continue
+			}
+
+			id, _ := strconv.Atoi(ffTransactions.ID)
+			ffAmount, err := money.Parse(ffTransaction.Amount)
+			if err != nil {
+				return -1, err
+			}
+			if ffTransaction.Source == transaction.Source && ffTransaction.Destination == transaction.Destination && ffAmount.Equal(amount) && c.claim(id) {
+				return id, nil
+			}
+		}
+	}
+
+	return -1, nil
+}
+
+// PushTransaction creates the transaction and returns the ID of the new transaction group
+func (c *Client) PushTransaction(transaction FireflyTransaction) (int, error) {
+	requestData := FireflyTransactionRequest{
+		ErrorIfDuplicateHash: false,
+		ApplyRules:           false,
+		Transactions:         []FireflyTransaction{transaction},
+	}
+	// a split transaction is sent as a group, which needs a title
+	if len(transaction.Splits) > 0 {
+		requestData.GroupTitle = transaction.Description
+		requestData.Transactions = transaction.Splits
+	}
+	data, _ := json.Marshal(requestData)
+	requestUrl := fmt.Sprintf("%s/api/v1/transactions", c.URL)
+
+	req, err := http.NewRequest(http.MethodPost, requestUrl, bytes.NewBuffer(data))
+	if err != nil {
+		return -1, err
+	}
+
+	res, err := c.sendRequest(req)
+	if err != nil {
+		return -1, err
+	}
+	data, err = readResponse(res, http.StatusOK)
+	if err != nil {
+		return -1, err
+	}
+
+	var body FireflyTransactionCreateResponse
+	if err := json.Unmarshal(data, &body); err != nil {
+		return -1, fmt.Errorf("decode response of %s: %w", req.URL.Path, err)
+	}
+	id, err := strconv.Atoi(body.Data.ID)
+	if err != nil {
+		return -1, fmt.Errorf("invalid transaction ID %q in response of %s", body.Data.ID, req.URL.Path)
+	}
+	c.claim(id)
+	return id, nil
+}
+
+// DeleteTransaction deletes the transaction group with the given ID. It
+// returns a NotFoundError if the transaction doesn't exist.
+func (c *Client) DeleteTransaction(id int) error {
+	requestUrl := fmt.Sprintf("%s/api/v1/transactions/%d", c.URL, id)
+	req, err := http.NewRequest(http.MethodDelete, requestUrl, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.sendRequest(req)
+	if err != nil {
+		return err
+	}
+	_, err = readResponse(res, http.StatusNoContent)
+	return err
+}
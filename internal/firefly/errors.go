@@ -0,0 +1,141 @@
+package firefly
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// APIError is returned for every response of Firefly III with an unexpected
+// status code. Depending on the status code it's wrapped in one of the more
+// specific errors below, use errors.As to check for them.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	// RequestID is the X-Request-Id header of the response, which can be
+	// used to find the request in the logs of Firefly III
+	RequestID string
+	// Message is the message of the response, if there is one
+	Message string
+	Body    []byte
+}
+
+func (e *APIError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = strings.TrimSpace(string(e.Body))
+		if len(message) > 200 {
+			message = message[:200] + "..."
+		}
+	}
+
+	text := fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+	if message != "" {
+		text += ": " + message
+	}
+	if e.RequestID != "" {
+		text += fmt.Sprintf(" (request ID %s)", e.RequestID)
+	}
+	return text
+}
+
+// AuthError is returned if the token is invalid or expired (401) or it
+// isn't allowed to access the resource (403)
+type AuthError struct {
+	APIError
+}
+
+func (e *AuthError) Unwrap() error { return &e.APIError }
+
+// NotFoundError is returned if the resource doesn't exist (404)
+type NotFoundError struct {
+	APIError
+}
+
+func (e *NotFoundError) Unwrap() error { return &e.APIError }
+
+// ValidationError is returned if Firefly III rejected the data of the request (422)
+type ValidationError struct {
+	APIError
+	// Errors are the messages of Firefly III by field, e.g. "transactions.0.destination_name"
+	Errors map[string][]string
+}
+
+func (e *ValidationError) Unwrap() error { return &e.APIError }
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Errors))
+	for field := range e.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	text := e.APIError.Error()
+	for _, field := range fields {
+		text += fmt.Sprintf("\n  %s: %s", field, strings.Join(e.Errors[field], ", "))
+	}
+	return text
+}
+
+// ServerError is returned if Firefly III failed to handle the request (5xx)
+type ServerError struct {
+	APIError
+}
+
+func (e *ServerError) Unwrap() error { return &e.APIError }
+
+// errorResponse is the body of an error response of Firefly III
+type errorResponse struct {
+	Message string              `json:"message"`
+	Errors  map[string][]string `json:"errors"`
+}
+
+// newAPIError returns the error for a response with an unexpected status code
+func newAPIError(res *http.Response, body []byte) error {
+	apiError := APIError{
+		StatusCode: res.StatusCode,
+		RequestID:  res.Header.Get("X-Request-Id"),
+		Body:       body,
+	}
+	if res.Request != nil {
+		apiError.Method = res.Request.Method
+		apiError.Path = res.Request.URL.Path
+	}
+
+	var response errorResponse
+	if err := json.Unmarshal(body, &response); err == nil {
+		apiError.Message = response.Message
+	}
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return &AuthError{apiError}
+	case res.StatusCode == http.StatusNotFound:
+		return &NotFoundError{apiError}
+	case res.StatusCode == http.StatusUnprocessableEntity:
+		return &ValidationError{APIError: apiError, Errors: response.Errors}
+	case res.StatusCode >= 500:
+		return &ServerError{apiError}
+	}
+	return &apiError
+}
+
+// readResponse reads and closes the body of the response. It returns an
+// error if the status code isn't one of the expected ones.
+func readResponse(res *http.Response, expected ...int) ([]byte, error) {
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range expected {
+		if res.StatusCode == status {
+			return body, nil
+		}
+	}
+	return body, newAPIError(res, body)
+}
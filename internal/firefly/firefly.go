@@ -1,52 +1,86 @@
 package firefly
 
 import (
-	"bytes"
-	"encoding/json"
 	"fireflysync/internal/config"
 	"fireflysync/internal/csv"
 	"fmt"
-	"math"
-	"net/http"
-	"net/url"
-	"regexp"
-	"strconv"
 	"time"
 )
 
 type FireflyTransaction struct {
-	RuleMatch       bool
+	RuleMatch bool
+	// Rules are the indexes of all rules which were applied, starting at 0
+	Rules           []int        `json:"-"`
 	Type            string       `json:"type"`
 	Date            csv.DateTime `json:"date"`
 	Amount          string       `json:"amount"`
+	Currency        string       `json:"currency_code,omitempty"`
 	Description     string       `json:"description"`
 	ForeignAmount   string       `json:"foreign_amount,omitempty"`
 	ForeignCurrency string       `json:"foreign_currency_code,omitempty"`
 	Category        string       `json:"category_name"`
 	Source          string       `json:"source_name"`
 	Destination     string       `json:"destination_name"`
+	SourceID        string       `json:"source_id,omitempty"`
+	DestinationID   string       `json:"destination_id,omitempty"`
+	SourceIBAN      string       `json:"source_iban,omitempty"`
+	DestinationIBAN string       `json:"destination_iban,omitempty"`
+	ExternalID      string       `json:"external_id,omitempty"`
+	Tags            []string     `json:"tags,omitempty"`
+	Notes           string       `json:"notes,omitempty"`
+	Budget          string       `json:"budget_name,omitempty"`
+	Bill            string       `json:"bill_name,omitempty"`
+	PiggyBank       string       `json:"piggy_bank_name,omitempty"`
+	InterestDate    string       `json:"interest_date,omitempty"`
+	BookDate        string       `json:"book_date,omitempty"`
+	// Splits are the parts of the transaction if a rule splits it, they are
+	// sent as one transaction group instead of the transaction itself.
+	Splits []FireflyTransaction `json:"-"`
+	// CounterpartyByRule is true if a rule set the destination, the IBAN of
+	// the csv row isn't used to find the account then
+	CounterpartyByRule bool `json:"-"`
 }
 
 type FireflyTransactionRequest struct {
 	ErrorIfDuplicateHash bool                 `json:"error_if_duplicate_hash"`
 	ApplyRules           bool                 `json:"apply_rules"`
+	GroupTitle           string               `json:"group_title,omitempty"`
 	Transactions         []FireflyTransaction `json:"transactions"`
 }
 
+type FireflyTransactionGroup struct {
+	Type       string `json:"type"`
+	ID         string `json:"id"`
+	Attributes struct {
+		CreatedAt            time.Time            `json:"created_at"`
+		UpdatedAt            time.Time            `json:"updated_at"`
+		User                 string               `json:"user"`
+		ErrorIfDuplicateHash bool                 `json:"error_if_duplicate_hash"`
+		ApplyRules           bool                 `json:"apply_rules"`
+		GroupTitle           string               `json:"group_title"`
+		Transactions         []FireflyTransaction `json:"transactions"`
+	} `json:"attributes"`
+}
+
+// FireflyPagination is part of every response which returns a list
+type FireflyPagination struct {
+	Meta struct {
+		Pagination struct {
+			Total       int `json:"total"`
+			Count       int `json:"count"`
+			PerPage     int `json:"per_page"`
+			CurrentPage int `json:"current_page"`
+			TotalPages  int `json:"total_pages"`
+		} `json:"pagination"`
+	} `json:"meta"`
+	Links struct {
+		Next string `json:"next"`
+	} `json:"links"`
+}
+
 type FireflyTransactionSearchResponse struct {
-	Data []struct {
-		Type       string `json:"type"`
-		ID         string `json:"id"`
-		Attributes struct {
-			CreatedAt            time.Time            `json:"created_at"`
-			UpdatedAt            time.Time            `json:"updated_at"`
-			User                 string               `json:"user"`
-			ErrorIfDuplicateHash bool                 `json:"error_if_duplicate_hash"`
-			ApplyRules           bool                 `json:"apply_rules"`
-			GroupTitle           string               `json:"group_title"`
-			Transactions         []FireflyTransaction `json:"transactions"`
-		} `json:"attributes"`
-	} `json:"data"`
+	Data []FireflyTransactionGroup `json:"data"`
+	FireflyPagination
 }
 
 type FireflyTransactionCreateResponse struct {
@@ -56,42 +90,29 @@ type FireflyTransactionCreateResponse struct {
 	} `json:"data"`
 }
 
-func matchRule(transaction csv.CsvTransaction, rules []config.Rule) config.RuleData {
-	//match against IBAN first since it's the most specific
-	for _, rule := range rules {
-		if rule.Match.IBAN == "" || transaction.IBAN == "" {
-			continue
-		}
-		if rule.Match.IBAN == transaction.IBAN {
-			return rule.Data
-		}
-	}
-
-	// match against reciever (regular expression)
-	for _, rule := range rules {
-		if rule.Match.Reciever == "" || transaction.Reciever == "" {
-			continue
-		}
-		match, err := regexp.MatchString(rule.Match.Reciever, transaction.Reciever)
-		if err != nil {
-			panic(err)
-		}
-		if match {
-			return rule.Data
-		}
+func ProcessTransaction(inputTransaction csv.CsvTransaction, rules *config.RuleSet, defaults config.Defaults) (FireflyTransaction, error) {
+	match, ruleMatch, err := rules.Match(inputTransaction)
+	if err != nil {
+		return FireflyTransaction{}, err
 	}
+	rule := match.Data
+	data := config.TemplateData(inputTransaction, match.Captures)
 
-	return config.RuleData{}
-}
-
-func ProcessTransaction(inputTransaction csv.CsvTransaction, rules []config.Rule, defaults config.Defaults) FireflyTransaction {
 	var outputTransaction FireflyTransaction
+	outputTransaction.Rules = match.Rules
 	outputTransaction.Date = inputTransaction.Date
-	outputTransaction.Description = "Placeholder: " + inputTransaction.Reciever
-	outputTransaction.Amount = fmt.Sprintf("%.2f", math.Abs(inputTransaction.Amount))
+	outputTransaction.ExternalID = inputTransaction.Fingerprint
+	outputTransaction.Amount = inputTransaction.Amount.Abs().Format(inputTransaction.Currency)
+	outputTransaction.Currency = inputTransaction.Currency
+
+	description, err := config.Render(defaults.DescriptionTemplate(), data)
+	if err != nil {
+		return outputTransaction, fmt.Errorf("defaults.description: %w", err)
+	}
+	outputTransaction.Description = description
 
 	if inputTransaction.ForeignCurrency != "" {
-		outputTransaction.ForeignAmount = fmt.Sprintf("%.2f", math.Abs(inputTransaction.ForeignAmount))
+		outputTransaction.ForeignAmount = inputTransaction.ForeignAmount.Abs().Format(inputTransaction.ForeignCurrency)
 		outputTransaction.ForeignCurrency = inputTransaction.ForeignCurrency
 	}
 
@@ -99,7 +120,7 @@ func ProcessTransaction(inputTransaction csv.CsvTransaction, rules []config.Rule
 	outputTransaction.Source = defaults.Source
 	outputTransaction.Destination = defaults.Destination
 
-	withdraw := inputTransaction.Amount < 0
+	withdraw := inputTransaction.Amount.Sign() < 0
 
 	if withdraw {
 		outputTransaction.Type = "withdrawal"
@@ -107,8 +128,7 @@ func ProcessTransaction(inputTransaction csv.CsvTransaction, rules []config.Rule
 		outputTransaction.Type = "deposit"
 	}
 
-	rule := matchRule(inputTransaction, rules)
-	if rule != (config.RuleData{}) {
+	if ruleMatch && !rule.IsEmpty() {
 		outputTransaction.RuleMatch = true
 
 		if rule.Internal {
@@ -129,115 +149,34 @@ func ProcessTransaction(inputTransaction csv.CsvTransaction, rules []config.Rule
 
 		if rule.Destination != "" {
 			outputTransaction.Destination = rule.Destination
+			outputTransaction.CounterpartyByRule = true
+		}
+
+		outputTransaction.Tags = rule.Tags
+		outputTransaction.Notes = rule.Notes
+		outputTransaction.Budget = rule.Budget
+		outputTransaction.Bill = rule.Bill
+		outputTransaction.PiggyBank = rule.PiggyBank
+		outputTransaction.InterestDate = rule.InterestDate
+		outputTransaction.BookDate = rule.BookDate
+
+		if len(rule.Splits) > 0 {
+			splits, err := split(outputTransaction, inputTransaction.Amount.Abs(), inputTransaction.Currency, rule.Splits)
+			if err != nil {
+				return outputTransaction, fmt.Errorf("rule %d: %w", match.Rule+1, err)
+			}
+			outputTransaction.Splits = splits
 		}
 	}
 
 	// if it isn't a withdraw we need to swap the source and destination
 	if !withdraw {
 		outputTransaction.Source, outputTransaction.Destination = outputTransaction.Destination, outputTransaction.Source
-	}
-
-	return outputTransaction
-}
-
-type Client struct {
-	URL                   string
-	Token                 string
-	HTTPClient            *http.Client
-	MatchedTransactionIDs map[int]bool
-}
-
-func NewClient(url, token string) *Client {
-	return &Client{
-		URL:   url,
-		Token: token,
-		HTTPClient: &http.Client{
-			Timeout: time.Minute,
-		},
-		MatchedTransactionIDs: make(map[int]bool),
-	}
-}
-
-func (c *Client) sendRequest(req *http.Request) (*http.Response, error) {
-	req.Header.Add("Authorization", "Bearer "+c.Token)
-	req.Header.Add("Content-Type", "application/json; charset=UTF-8")
-	req.Header.Add("Accept", "application/vnd.api+json")
-	return c.HTTPClient.Do(req)
-}
-
-// Returns with a Firefly Transaction ID if it found a matching transaction
-func (c *Client) GetTransaction(transaction FireflyTransaction) (int, error) {
-	requestUrl := fmt.Sprintf("%s/api/v1/transactions", c.URL)
-	req, err := http.NewRequest(http.MethodGet, requestUrl, nil)
-	if err != nil {
-		return -1, err
-	}
-
-	params := url.Values{}
-	params.Add("start", transaction.Date.Format("2006-01-02"))
-	params.Add("end", transaction.Date.Format("2006-01-02"))
-	req.URL.RawQuery = params.Encode()
-
-	res, err := c.sendRequest(req)
-	if err != nil {
-		return -1, err
-	}
-	defer res.Body.Close()
-
-	var data FireflyTransactionSearchResponse
-	json.NewDecoder(res.Body).Decode(&data)
-
-	for _, ffTransactions := range data.Data {
-		for _, ffTransaction := range ffTransactions.Attributes.Transactions {
-			// TODO make matching logic more robust
-			id, _ := strconv.Atoi(ffTransactions.ID)
-			ffAmount, _ := strconv.ParseFloat(ffTransaction.Amount, 64)
-			amount, _ := strconv.ParseFloat(transaction.Amount, 64)
-			alreadyMatched := c.MatchedTransactionIDs[id]
-			if ffTransaction.Source == transaction.Source && ffTransaction.Destination == transaction.Destination && ffAmount == amount && !alreadyMatched {
-				c.MatchedTransactionIDs[id] = true
-				return id, nil
-			}
+		for i := range outputTransaction.Splits {
+			split := &outputTransaction.Splits[i]
+			split.Source, split.Destination = split.Destination, split.Source
 		}
 	}
 
-	return -1, nil
-}
-
-func (c *Client) PushTransaction(transaction FireflyTransaction) error {
-	requestData := FireflyTransactionRequest{
-		ErrorIfDuplicateHash: false,
-		ApplyRules:           false,
-		Transactions:         []FireflyTransaction{transaction},
-	}
-	data, _ := json.Marshal(requestData)
-	requestUrl := fmt.Sprintf("%s/api/v1/transactions", c.URL)
-
-	req, err := http.NewRequest(http.MethodPost, requestUrl, bytes.NewBuffer(data))
-	if err != nil {
-		return err
-	}
-
-	res, err := c.sendRequest(req)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	var body FireflyTransactionCreateResponse
-	json.NewDecoder(res.Body).Decode(&body)
-
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d %s", res.StatusCode, body)
-	}
-
-	id, err := strconv.Atoi(body.Data.ID)
-	if err != nil {
-		return err
-	}
-	c.MatchedTransactionIDs[id] = true
-
-	fmt.Println("Transaction created with ID: ", id)
-
-	return nil
+	return outputTransaction, nil
 }
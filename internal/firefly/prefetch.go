@@ -0,0 +1,137 @@
+package firefly
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// prefetchDays is the maximum number of days which are loaded with one request
+const prefetchDays = 31
+
+// parallel calls work for 0 to count-1 with up to concurrency calls at the
+// same time and returns the error of the lowest index
+func parallel(count, concurrency int, work func(i int) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	errs := make([]error, count)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency && worker < count; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = work(i)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dateRange is a range of days, both inclusive
+type dateRange struct {
+	start, end time.Time
+}
+
+// missingRanges returns the days around the transactions which aren't cached
+// yet, merged into ranges of at most prefetchDays days
+func (c *Client) missingRanges(transactions []FireflyTransaction) []dateRange {
+	days := []time.Time{}
+	seen := make(map[string]bool)
+	for _, transaction := range transactions {
+		start, end := c.window(transaction.Date.Time)
+		for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+			key := day.Format("2006-01-02")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if _, _, missing := c.missingDays(day, day); missing {
+				days = append(days, day)
+			}
+		}
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Before(days[j])
+	})
+
+	ranges := []dateRange{}
+	for _, day := range days {
+		if len(ranges) > 0 {
+			last := &ranges[len(ranges)-1]
+			if last.end.AddDate(0, 0, 1).Equal(day) && day.Sub(last.start) < prefetchDays*24*time.Hour {
+				last.end = day
+				continue
+			}
+		}
+		ranges = append(ranges, dateRange{start: day, end: day})
+	}
+	return ranges
+}
+
+// Prefetch loads the existing transactions around the dates of all
+// transactions with up to concurrency requests at the same time.
+// GetTransaction then finds duplicates without asking Firefly III again.
+func (c *Client) Prefetch(transactions []FireflyTransaction, concurrency int) error {
+	ranges := c.missingRanges(transactions)
+	return parallel(len(ranges), concurrency, func(i int) error {
+		return c.fetchTransactions(ranges[i].start, ranges[i].end)
+	})
+}
+
+// SearchExternalIDs searches all of Firefly III for the external IDs of the
+// transactions which aren't found around their date, e.g. because the date was
+// changed in Firefly III, with up to concurrency requests at the same time.
+// Every search is a request of its own, so it should only be used for
+// transactions which might have been created before.
+func (c *Client) SearchExternalIDs(transactions []FireflyTransaction, concurrency int) error {
+	search := []string{}
+	for _, transaction := range transactions {
+		if transaction.ExternalID == "" {
+			continue
+		}
+		groups, err := c.transactionsOn(transaction.Date.Time)
+		if err != nil {
+			return err
+		}
+		if !hasExternalID(groups, transaction.ExternalID) {
+			search = append(search, transaction.ExternalID)
+		}
+	}
+
+	return parallel(len(search), concurrency, func(i int) error {
+		ids, err := c.searchExternalID(search[i])
+		if err != nil {
+			return err
+		}
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.externalIDs[search[i]] = ids
+		return nil
+	})
+}
+
+func hasExternalID(groups []FireflyTransactionGroup, externalID string) bool {
+	for _, group := range groups {
+		for _, transaction := range group.Attributes.Transactions {
+			if transaction.ExternalID == externalID {
+				return true
+			}
+		}
+	}
+	return false
+}
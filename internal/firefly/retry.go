@@ -0,0 +1,167 @@
+package firefly
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults of the retries, see Client.Retries
+const (
+	DefaultRetries    = 3
+	DefaultBackoff    = time.Second
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// rateLimiter spaces the requests evenly, it's safe for concurrent use
+type rateLimiter struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// wait blocks until the next request may be sent
+func (l *rateLimiter) wait() {
+	l.mutex.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mutex.Unlock()
+
+	time.Sleep(delay)
+}
+
+// SetRateLimit limits the number of requests per second, 0 removes the limit
+func (c *Client) SetRateLimit(requestsPerSecond float64) {
+	if requestsPerSecond <= 0 {
+		c.limiter = nil
+		return
+	}
+	c.limiter = &rateLimiter{interval: time.Duration(float64(time.Second) / requestsPerSecond)}
+}
+
+var (
+	randomMutex sync.Mutex
+	random      = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// backoff returns the wait before the given retry, starting at 1. It doubles
+// with every retry up to MaxBackoff and a random part of up to half of it is
+// removed, so that several clients don't retry at the same time.
+func (c *Client) backoff(retry int) time.Duration {
+	wait := c.Backoff
+	for i := 1; i < retry && wait < c.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if c.MaxBackoff > 0 && wait > c.MaxBackoff {
+		wait = c.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+
+	randomMutex.Lock()
+	jitter := time.Duration(random.Int63n(int64(wait)/2 + 1))
+	randomMutex.Unlock()
+	return wait - jitter
+}
+
+// retryAfter returns the wait requested by the Retry-After header of the
+// response, which is either a number of seconds or a date.
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// idempotent reports if sending the request twice has the same effect as sending it once
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryable reports if the request should be repeated after the given
+// response or error. Firefly III didn't process a request which was answered
+// with 429, so all requests are repeated then. Server and connection errors
+// are only retried for idempotent requests, a POST might have been processed.
+func retryable(req *http.Request, res *http.Response, err error) bool {
+	if err != nil {
+		return idempotent(req) && !errors.Is(err, req.Context().Err())
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(req)
+	}
+	return false
+}
+
+// do sends the request and repeats it after transient errors
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	for retry := 1; ; retry++ {
+		if c.limiter != nil {
+			c.limiter.wait()
+		}
+
+		res, err := c.HTTPClient.Do(req)
+		if retry > c.Retries || !retryable(req, res, err) {
+			return res, err
+		}
+		// the body of the request was already read
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return res, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return res, err
+			}
+			req.Body = body
+		}
+
+		wait := c.backoff(retry)
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = res.Status
+			if after, ok := retryAfter(res); ok {
+				wait = after
+			}
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		log.Printf("%s %s failed: %s, retry %d of %d in %s", req.Method, req.URL.Path, reason, retry, c.Retries, wait.Round(time.Millisecond))
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, req.Context().Err())
+		}
+	}
+}
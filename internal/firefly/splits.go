@@ -0,0 +1,85 @@
+package firefly
+
+import (
+	"fireflysync/internal/config"
+	"fireflysync/internal/money"
+	"fmt"
+)
+
+// splitAmounts divides the total amount among the splits. Percentages are
+// rounded to the precision of the currency, the rounding difference is added
+// to the remainder or to the last percentage if all of them add up to 100.
+func splitAmounts(total money.Amount, currency string, splits []config.Split) ([]money.Amount, error) {
+	places := money.Precision(currency)
+	hundredth := money.MustParse("0.01")
+
+	amounts := make([]money.Amount, len(splits))
+	rest := total
+	percent := money.Amount{}
+	remainder, last := -1, -1
+	for i, split := range splits {
+		switch {
+		case split.Remainder:
+			remainder = i
+			continue
+		case split.Percent != nil:
+			amounts[i] = total.Mul(*split.Percent).Mul(hundredth).Round(places)
+			percent = percent.Add(*split.Percent)
+			last = i
+		case split.Amount != nil:
+			amounts[i] = *split.Amount
+		}
+		rest = rest.Sub(amounts[i])
+	}
+
+	switch {
+	case remainder >= 0:
+		if rest.Sign() < 0 {
+			return nil, fmt.Errorf("splits add up to %s, which is more than the amount of %s", total.Sub(rest).Format(currency), total.Format(currency))
+		}
+		amounts[remainder] = rest
+	case last >= 0 && percent.Equal(money.MustParse("100")):
+		amounts[last] = amounts[last].Add(rest)
+	case !rest.IsZero():
+		return nil, fmt.Errorf("splits add up to %s instead of the amount of %s", total.Sub(rest).Format(currency), total.Format(currency))
+	}
+
+	for i, amount := range amounts {
+		if amount.Sign() <= 0 {
+			return nil, fmt.Errorf("split %d would be %s, the amount of %s is too small for the splits", i+1, amount.Format(currency), total.Format(currency))
+		}
+	}
+	return amounts, nil
+}
+
+// split returns the parts of the transaction as defined by the splits of a
+// rule. Every part is a copy of the transaction with its own amount.
+func split(transaction FireflyTransaction, total money.Amount, currency string, splits []config.Split) ([]FireflyTransaction, error) {
+	amounts, err := splitAmounts(total, currency, splits)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := []FireflyTransaction{}
+	for i, split := range splits {
+		part := transaction
+		part.Amount = amounts[i].Format(currency)
+		// a foreign amount can't be divided like the amount
+		part.ForeignAmount = ""
+		part.ForeignCurrency = ""
+		if split.Destination != "" {
+			part.Destination = split.Destination
+		}
+		if split.Category != "" {
+			part.Category = split.Category
+		}
+		if split.Budget != "" {
+			part.Budget = split.Budget
+		}
+		if split.Description != "" {
+			part.Description = split.Description
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fireflysync/internal/firefly"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/olekukonko/tablewriter"
 )
@@ -32,8 +33,23 @@ func PrintTransaction(input csv.CsvTransaction, output firefly.FireflyTransactio
 	data = printRow(data, "Destination", "", output.Destination)
 	data = printRow(data, "Category", "", output.Category)
 	data = printRow(data, "Description", "", output.Description)
+	data = printRow(data, "Tags", "", strings.Join(output.Tags, ", "))
+	data = printRow(data, "Notes", "", output.Notes)
+	data = printRow(data, "Budget", "", output.Budget)
+	data = printRow(data, "Bill", "", output.Bill)
+	data = printRow(data, "Piggy bank", "", output.PiggyBank)
+	data = printRow(data, "Interest date", "", output.InterestDate)
+	data = printRow(data, "Book date", "", output.BookDate)
 	data = printRow(data, "Type", "", output.Type)
-	data = printRow(data, "Amount", fmt.Sprintf("%.02f", input.Amount), output.Amount)
+	data = printRow(data, "Amount", input.Amount.Format(input.Currency), output.Amount)
+	for i, split := range output.Splits {
+		data = printRow(data, fmt.Sprintf("Split %d", i+1), "", split.Amount)
+		data = printRow(data, "  Description", "", split.Description)
+		data = printRow(data, "  Source", "", split.Source)
+		data = printRow(data, "  Destination", "", split.Destination)
+		data = printRow(data, "  Category", "", split.Category)
+		data = printRow(data, "  Budget", "", split.Budget)
+	}
 
 	table.AppendBulk(data)
 	table.Render()
@@ -0,0 +1,278 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	// StatusImported means the row was pushed to Firefly
+	StatusImported Status = "imported"
+	// StatusDuplicate means the row already existed in Firefly
+	StatusDuplicate Status = "duplicate"
+	// StatusFailed means pushing the row failed, it's retried on the next run
+	StatusFailed Status = "failed"
+)
+
+type Entry struct {
+	FireflyID   int       `json:"firefly_id,omitempty"`
+	Status      Status    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	RunID       string    `json:"run_id,omitempty"`
+	Date        string    `json:"date,omitempty"`
+	Amount      string    `json:"amount,omitempty"`
+	Description string    `json:"description,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Run is a single execution of an import
+type Run struct {
+	CSV       string    `json:"csv"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Ledger records the state of every CSV row by its fingerprint, so rows which
+// were already handled can be skipped without asking Firefly again. It's safe
+// for concurrent use.
+//
+// Record only appends the entry to a journal next to the ledger, which is
+// merged into the ledger by Save and Close. A journal which is left behind by
+// an interrupted run is merged when the ledger is opened the next time.
+type Ledger struct {
+	path    string
+	mutex   sync.Mutex
+	journal *os.File
+	Entries map[string]Entry `json:"entries"`
+	Runs    map[string]Run   `json:"runs"`
+}
+
+// journalEntry is a line of the journal
+type journalEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	Entry
+}
+
+// Open reads the ledger from the given path, a missing file results in an empty ledger
+func Open(path string) (*Ledger, error) {
+	ledger := &Ledger{
+		path:    path,
+		Entries: make(map[string]Entry),
+		Runs:    make(map[string]Run),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, ledger); err != nil {
+			return nil, err
+		}
+	}
+	if ledger.Entries == nil {
+		ledger.Entries = make(map[string]Entry)
+	}
+	if ledger.Runs == nil {
+		ledger.Runs = make(map[string]Run)
+	}
+
+	if err := ledger.replay(); err != nil {
+		return nil, err
+	}
+	return ledger, nil
+}
+
+func (l *Ledger) journalPath() string {
+	return l.path + ".journal"
+}
+
+// replay applies the entries of a journal which wasn't merged yet
+func (l *Ledger) replay() error {
+	file, err := os.Open(l.journalPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		// a line without a newline was cut off while it was written
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var entry journalEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return fmt.Errorf("%s:%d: %w", l.journalPath(), line, err)
+		}
+		l.Entries[entry.Fingerprint] = entry.Entry
+	}
+}
+
+// StartRun registers a new import run and returns its ID
+func (l *Ledger) StartRun(csvPath string) (string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	id := now.Format("20060102-150405")
+	for i := 2; ; i++ {
+		if _, ok := l.Runs[id]; !ok {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", now.Format("20060102-150405"), i)
+	}
+
+	l.Runs[id] = Run{CSV: csvPath, StartedAt: now}
+	return id, l.save()
+}
+
+// RunEntries returns the rows which were imported by the given run, by their fingerprint
+func (l *Ledger) RunEntries(runID string) map[string]Entry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	entries := make(map[string]Entry)
+	for fingerprint, entry := range l.Entries {
+		if entry.RunID == runID && entry.Status == StatusImported {
+			entries[fingerprint] = entry
+		}
+	}
+	return entries
+}
+
+// Forget removes the row from the ledger, so it's imported again on the next run
+func (l *Ledger) Forget(fingerprint string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.Entries, fingerprint)
+	return l.save()
+}
+
+// RemoveRun removes the run and all rows which are still recorded for it
+func (l *Ledger) RemoveRun(runID string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for fingerprint, entry := range l.Entries {
+		if entry.RunID == runID {
+			delete(l.Entries, fingerprint)
+		}
+	}
+	delete(l.Runs, runID)
+	return l.save()
+}
+
+func (l *Ledger) Get(fingerprint string) (Entry, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	entry, ok := l.Entries[fingerprint]
+	return entry, ok
+}
+
+// Done reports if the row was already imported or found as duplicate
+func (l *Ledger) Done(fingerprint string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	entry, ok := l.Entries[fingerprint]
+	return ok && (entry.Status == StatusImported || entry.Status == StatusDuplicate)
+}
+
+// Record stores the entry and appends it to the journal right away, so an
+// interrupted run doesn't lose any state.
+func (l *Ledger) Record(fingerprint string, entry Entry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	entry.UpdatedAt = time.Now()
+	l.Entries[fingerprint] = entry
+
+	if l.journal == nil {
+		journal, err := os.OpenFile(l.journalPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		l.journal = journal
+	}
+	data, err := json.Marshal(journalEntry{Fingerprint: fingerprint, Entry: entry})
+	if err != nil {
+		return err
+	}
+	_, err = l.journal.Write(append(data, '\n'))
+	return err
+}
+
+// Save writes the ledger to a temporary file first and then replaces the
+// old file, so the ledger is never left half written. The journal is removed
+// afterwards.
+func (l *Ledger) Save() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.save()
+}
+
+// Close merges the journal into the ledger if anything was recorded
+func (l *Ledger) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.journal == nil {
+		return nil
+	}
+	return l.save()
+}
+
+func (l *Ledger) save() error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(l.path), filepath.Base(l.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return err
+	}
+
+	// the entries of the journal are part of the ledger now
+	if l.journal != nil {
+		l.journal.Close()
+		l.journal = nil
+	}
+	if err := os.Remove(l.journalPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
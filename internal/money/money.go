@@ -0,0 +1,234 @@
+package money
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Amount is an exact decimal amount of money. It's stored as an integer
+// number of units at a given scale, so 12.34 is stored as 1234 with scale 2.
+type Amount struct {
+	units int64
+	scale int
+}
+
+// precisions lists the currencies which don't use two decimal places
+var precisions = map[string]int{
+	"BHD": 3,
+	"BIF": 0,
+	"CLP": 0,
+	"DJF": 0,
+	"GNF": 0,
+	"IQD": 3,
+	"ISK": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KMF": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"LYD": 3,
+	"OMR": 3,
+	"PYG": 0,
+	"RWF": 0,
+	"TND": 3,
+	"UGX": 0,
+	"UYI": 0,
+	"VND": 0,
+	"VUV": 0,
+	"XAF": 0,
+	"XOF": 0,
+	"XPF": 0,
+}
+
+// Precision returns the number of decimal places used by the ISO 4217 currency
+func Precision(currency string) int {
+	if precision, ok := precisions[strings.ToUpper(currency)]; ok {
+		return precision
+	}
+	return 2
+}
+
+func pow10(exponent int) int64 {
+	result := int64(1)
+	for i := 0; i < exponent; i++ {
+		result *= 10
+	}
+	return result
+}
+
+// Parse reads a plain decimal number like "-1234.56". Trailing zeros of the
+// fraction are dropped, so "12.340000000000" as returned by Firefly equals "12.34".
+func Parse(value string) (Amount, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Amount{}, fmt.Errorf("invalid amount %q", value)
+	}
+
+	integer, fraction := value, ""
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		integer, fraction = value[:i], value[i+1:]
+	}
+	fraction = strings.TrimRight(fraction, "0")
+
+	for _, char := range fraction {
+		if char < '0' || char > '9' {
+			return Amount{}, fmt.Errorf("invalid amount %q", value)
+		}
+	}
+	if integer == "" || integer == "-" || integer == "+" {
+		integer += "0"
+	}
+
+	units, err := strconv.ParseInt(integer+fraction, 10, 64)
+	if err != nil {
+		return Amount{}, fmt.Errorf("invalid amount %q", value)
+	}
+	return Amount{units: units, scale: len(fraction)}, nil
+}
+
+// MustParse is like Parse but panics if the value isn't a valid amount
+func MustParse(value string) Amount {
+	amount, err := Parse(value)
+	if err != nil {
+		panic(err)
+	}
+	return amount
+}
+
+// rescale returns the units of the amount at a larger scale
+func (a Amount) rescale(scale int) int64 {
+	return a.units * pow10(scale-a.scale)
+}
+
+func align(a, b Amount) (int64, int64, int) {
+	scale := a.scale
+	if b.scale > scale {
+		scale = b.scale
+	}
+	return a.rescale(scale), b.rescale(scale), scale
+}
+
+func (a Amount) Add(b Amount) Amount {
+	x, y, scale := align(a, b)
+	return Amount{units: x + y, scale: scale}
+}
+
+func (a Amount) Sub(b Amount) Amount {
+	return a.Add(b.Neg())
+}
+
+// Mul returns the exact product of both amounts
+func (a Amount) Mul(b Amount) Amount {
+	return Amount{units: a.units * b.units, scale: a.scale + b.scale}
+}
+
+func (a Amount) Neg() Amount {
+	return Amount{units: -a.units, scale: a.scale}
+}
+
+func (a Amount) Abs() Amount {
+	if a.units < 0 {
+		return a.Neg()
+	}
+	return a
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of the amount
+func (a Amount) Sign() int {
+	switch {
+	case a.units < 0:
+		return -1
+	case a.units > 0:
+		return 1
+	}
+	return 0
+}
+
+func (a Amount) IsZero() bool {
+	return a.units == 0
+}
+
+// Cmp compares both amounts and returns -1, 0 or +1
+func (a Amount) Cmp(b Amount) int {
+	x, y, _ := align(a, b)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func (a Amount) Equal(b Amount) bool {
+	return a.Cmp(b) == 0
+}
+
+// Round rounds the amount half away from zero to the given decimal places
+func (a Amount) Round(places int) Amount {
+	if a.scale <= places {
+		return a
+	}
+
+	divisor := pow10(a.scale - places)
+	units, remainder := a.units/divisor, a.units%divisor
+	if remainder*2 >= divisor {
+		units++
+	} else if remainder*2 <= -divisor {
+		units--
+	}
+	return Amount{units: units, scale: places}
+}
+
+func (a Amount) format(places int) string {
+	units := a.rescale(places)
+	sign := ""
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+
+	digits := strconv.FormatInt(units, 10)
+	if places == 0 {
+		return sign + digits
+	}
+	if len(digits) <= places {
+		digits = strings.Repeat("0", places-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-places] + "." + digits[len(digits)-places:]
+}
+
+// String returns the exact value of the amount
+func (a Amount) String() string {
+	return a.format(a.scale)
+}
+
+// Format rounds the amount to the precision of the currency and always
+// prints all of its decimal places, e.g. "12.30" for EUR or "1234" for JPY.
+func (a Amount) Format(currency string) string {
+	places := Precision(currency)
+	return a.Round(places).format(places)
+}
+
+// UnmarshalYAML reports an invalid amount as yaml.TypeError with its line, so
+// that the decoder goes on and all mistakes of a config file are found at once.
+func (a *Amount) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+
+	amount, err := Parse(value)
+	if err != nil {
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: %v", node.Line, err)}}
+	}
+	*a = amount
+	return nil
+}
+
+func (a Amount) MarshalYAML() (interface{}, error) {
+	return a.String(), nil
+}
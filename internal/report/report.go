@@ -0,0 +1,190 @@
+package report
+
+import (
+	"encoding/json"
+	"fireflysync/internal/config"
+	"fireflysync/internal/csv"
+	"fireflysync/internal/firefly"
+	"fireflysync/internal/money"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Report collects how often each rule was applied and which recievers
+// didn't match any rule
+type Report struct {
+	currency     string
+	transactions int
+	matched      int
+	rules        []ruleStats
+	unmatched    map[string]*recieverStats
+}
+
+type ruleStats struct {
+	match  string
+	count  int
+	amount money.Amount
+}
+
+type recieverStats struct {
+	reciever string
+	count    int
+	amount   money.Amount
+}
+
+// RuleStats is the summary of a single rule
+type RuleStats struct {
+	// Rule is the number of the rule in the config, starting at 1
+	Rule         int    `json:"rule"`
+	Match        string `json:"match"`
+	Transactions int    `json:"transactions"`
+	Amount       string `json:"amount"`
+}
+
+// RecieverStats is the summary of all unmatched transactions of a reciever
+type RecieverStats struct {
+	Reciever     string `json:"reciever"`
+	Transactions int    `json:"transactions"`
+	Amount       string `json:"amount"`
+}
+
+// Summary is the result of a report as it's written as JSON
+type Summary struct {
+	Transactions int             `json:"transactions"`
+	Matched      int             `json:"matched"`
+	Currency     string          `json:"currency,omitempty"`
+	Rules        []RuleStats     `json:"rules"`
+	Unmatched    []RecieverStats `json:"unmatched"`
+}
+
+// describeMatch returns a short description of the conditions of a rule
+func describeMatch(match config.RuleMatch) string {
+	switch {
+	case match.IBAN != "":
+		return "iban: " + match.IBAN
+	case match.Reciever != "":
+		return "reciever: " + match.Reciever
+	}
+	return "conditions"
+}
+
+func New(rules []config.Rule) *Report {
+	report := &Report{unmatched: make(map[string]*recieverStats)}
+	for _, rule := range rules {
+		report.rules = append(report.rules, ruleStats{match: describeMatch(rule.Match)})
+	}
+	return report
+}
+
+// Add counts the transaction for all rules which were applied to it
+func (r *Report) Add(input csv.CsvTransaction, output firefly.FireflyTransaction) {
+	r.transactions++
+	if r.currency == "" {
+		r.currency = input.Currency
+	}
+
+	if len(output.Rules) > 0 {
+		r.matched++
+		for _, rule := range output.Rules {
+			r.rules[rule].count++
+			r.rules[rule].amount = r.rules[rule].amount.Add(input.Amount)
+		}
+		return
+	}
+
+	reciever := input.Reciever
+	if reciever == "" {
+		reciever = input.IBAN
+	}
+	stats, ok := r.unmatched[reciever]
+	if !ok {
+		stats = &recieverStats{reciever: reciever}
+		r.unmatched[reciever] = stats
+	}
+	stats.count++
+	stats.amount = stats.amount.Add(input.Amount)
+}
+
+// Summary returns the statistics of all rules in the order of the config and
+// the unmatched recievers sorted by the number of transactions.
+func (r *Report) Summary() Summary {
+	summary := Summary{
+		Transactions: r.transactions,
+		Matched:      r.matched,
+		Currency:     r.currency,
+		Rules:        []RuleStats{},
+		Unmatched:    []RecieverStats{},
+	}
+
+	for i, rule := range r.rules {
+		summary.Rules = append(summary.Rules, RuleStats{
+			Rule:         i + 1,
+			Match:        rule.match,
+			Transactions: rule.count,
+			Amount:       rule.amount.Format(r.currency),
+		})
+	}
+
+	unmatched := make([]*recieverStats, 0, len(r.unmatched))
+	for _, stats := range r.unmatched {
+		unmatched = append(unmatched, stats)
+	}
+	sort.Slice(unmatched, func(i, j int) bool {
+		if unmatched[i].count != unmatched[j].count {
+			return unmatched[i].count > unmatched[j].count
+		}
+		return unmatched[i].reciever < unmatched[j].reciever
+	})
+	for _, stats := range unmatched {
+		summary.Unmatched = append(summary.Unmatched, RecieverStats{
+			Reciever:     stats.reciever,
+			Transactions: stats.count,
+			Amount:       stats.amount.Format(r.currency),
+		})
+	}
+	return summary
+}
+
+func (r *Report) WriteTable(w io.Writer) {
+	summary := r.Summary()
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Rule", "Match", "Transactions", "Amount"})
+	for _, rule := range summary.Rules {
+		table.Append([]string{strconv.Itoa(rule.Rule), rule.Match, strconv.Itoa(rule.Transactions), rule.Amount})
+	}
+	table.Render()
+
+	if len(summary.Unmatched) > 0 {
+		table = tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Unmatched reciever", "Transactions", "Amount"})
+		for _, stats := range summary.Unmatched {
+			table.Append([]string{stats.Reciever, strconv.Itoa(stats.Transactions), stats.Amount})
+		}
+		table.Render()
+	}
+
+	fmt.Fprintf(w, "%d of %d transactions matched a rule\n", summary.Matched, summary.Transactions)
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r.Summary())
+}
+
+// Write writes the report in the given format, either table or json
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "table":
+		r.WriteTable(w)
+		return nil
+	case "json":
+		return r.WriteJSON(w)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
@@ -0,0 +1,157 @@
+package ruletest
+
+import (
+	"bytes"
+	"fireflysync/internal/config"
+	"fireflysync/internal/csv"
+	"fireflysync/internal/firefly"
+	"fireflysync/internal/money"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Case is a single rule test: a transaction of the CSV file and the fields
+// which the resulting Firefly transaction is expected to have.
+type Case struct {
+	Name   string `yaml:"name"`
+	Input  Input  `yaml:"input"`
+	Expect Expect `yaml:"expect"`
+}
+
+// Input contains the fields of a CSV row, amounts are negative for spending
+type Input struct {
+	Date            string       `yaml:"date"`
+	Reciever        string       `yaml:"reciever"`
+	IBAN            string       `yaml:"iban"`
+	TransactionType string       `yaml:"transaction_type"`
+	Reference       string       `yaml:"reference"`
+	Category        string       `yaml:"category"`
+	Amount          money.Amount `yaml:"amount"`
+	Currency        string       `yaml:"currency"`
+	ForeignAmount   money.Amount `yaml:"foreign_amount"`
+	ForeignCurrency string       `yaml:"foreign_currency"`
+}
+
+// Expect lists the expected fields of the Firefly transaction, fields which
+// are left out aren't checked.
+type Expect struct {
+	// Match is true if any rule is expected to match
+	Match        *bool     `yaml:"match"`
+	Type         *string   `yaml:"type"`
+	Source       *string   `yaml:"source"`
+	Destination  *string   `yaml:"destination"`
+	Category     *string   `yaml:"category"`
+	Description  *string   `yaml:"description"`
+	Amount       *string   `yaml:"amount"`
+	Tags         *[]string `yaml:"tags"`
+	Notes        *string   `yaml:"notes"`
+	Budget       *string   `yaml:"budget"`
+	Bill         *string   `yaml:"bill"`
+	PiggyBank    *string   `yaml:"piggy_bank"`
+	InterestDate *string   `yaml:"interest_date"`
+	BookDate     *string   `yaml:"book_date"`
+	// Splits is the expected number of splits
+	Splits *int `yaml:"splits"`
+}
+
+// Diff is a field which doesn't have the expected value
+type Diff struct {
+	Field    string
+	Expected string
+	Actual   string
+}
+
+func (d Diff) String() string {
+	return fmt.Sprintf("%s: expected %s, got %s", d.Field, d.Expected, d.Actual)
+}
+
+// Load reads a file with a list of test cases
+func Load(path string) ([]Case, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cases := []Case{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cases); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i := range cases {
+		if cases[i].Name == "" {
+			cases[i].Name = fmt.Sprintf("test %d", i+1)
+		}
+	}
+	return cases, nil
+}
+
+// Transaction returns the input as it would have been read from a CSV file
+func (i Input) Transaction() (csv.CsvTransaction, error) {
+	date, err := time.Parse("2006-01-02", i.Date)
+	if err != nil {
+		return csv.CsvTransaction{}, fmt.Errorf("date %q is not a date like 2006-01-02", i.Date)
+	}
+
+	return csv.CsvTransaction{
+		Date:            csv.DateTime{Time: date},
+		Reciever:        i.Reciever,
+		IBAN:            i.IBAN,
+		TransactionType: i.TransactionType,
+		Reference:       i.Reference,
+		Category:        i.Category,
+		Amount:          i.Amount,
+		Currency:        i.Currency,
+		ForeignAmount:   i.ForeignAmount,
+		ForeignCurrency: i.ForeignCurrency,
+	}, nil
+}
+
+// Run processes the input of the test case like an import and returns all
+// fields which don't have the expected value.
+func (c Case) Run(rules *config.RuleSet, defaults config.Defaults) ([]Diff, error) {
+	input, err := c.Input.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	output, err := firefly.ProcessTransaction(input, rules, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := []Diff{}
+	compare := func(field string, expected *string, actual string) {
+		if expected != nil && *expected != actual {
+			diffs = append(diffs, Diff{Field: field, Expected: fmt.Sprintf("%q", *expected), Actual: fmt.Sprintf("%q", actual)})
+		}
+	}
+
+	expect := c.Expect
+	if expect.Match != nil && *expect.Match != output.RuleMatch {
+		diffs = append(diffs, Diff{Field: "match", Expected: fmt.Sprint(*expect.Match), Actual: fmt.Sprint(output.RuleMatch)})
+	}
+	compare("type", expect.Type, output.Type)
+	compare("source", expect.Source, output.Source)
+	compare("destination", expect.Destination, output.Destination)
+	compare("category", expect.Category, output.Category)
+	compare("description", expect.Description, output.Description)
+	compare("amount", expect.Amount, output.Amount)
+	compare("notes", expect.Notes, output.Notes)
+	compare("budget", expect.Budget, output.Budget)
+	compare("bill", expect.Bill, output.Bill)
+	compare("piggy_bank", expect.PiggyBank, output.PiggyBank)
+	compare("interest_date", expect.InterestDate, output.InterestDate)
+	compare("book_date", expect.BookDate, output.BookDate)
+	if expect.Tags != nil && strings.Join(*expect.Tags, "\x00") != strings.Join(output.Tags, "\x00") {
+		diffs = append(diffs, Diff{Field: "tags", Expected: fmt.Sprintf("%q", *expect.Tags), Actual: fmt.Sprintf("%q", output.Tags)})
+	}
+	if expect.Splits != nil && *expect.Splits != len(output.Splits) {
+		diffs = append(diffs, Diff{Field: "splits", Expected: fmt.Sprint(*expect.Splits), Actual: fmt.Sprint(len(output.Splits))})
+	}
+	return diffs, nil
+}
@@ -0,0 +1,255 @@
+package suggest
+
+import (
+	"fireflysync/internal/config"
+	"fireflysync/internal/csv"
+	"fireflysync/internal/firefly"
+	"fireflysync/internal/money"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Suggestion is a rule learned from the existing transactions
+type Suggestion struct {
+	Rule config.Rule
+	// Support is the number of transactions of the counterparty
+	Support int
+	// Agreeing is the number of transactions which agree with all fields of the rule
+	Agreeing int
+}
+
+// Confidence is the share of the transactions which agree with the rule
+func (s Suggestion) Confidence() float64 {
+	if s.Support == 0 {
+		return 0
+	}
+	return float64(s.Agreeing) / float64(s.Support)
+}
+
+// Options control which suggestions are made
+type Options struct {
+	// MinSupport is the number of transactions a counterparty needs at least
+	MinSupport int
+	// MinConfidence is the share of transactions which have to agree on a field
+	MinConfidence float64
+	Defaults      config.Defaults
+	// Rules are the existing rules, counterparties which they match are skipped
+	Rules *config.RuleSet
+}
+
+// votes counts how often each value was seen
+type votes map[string]int
+
+// winner returns the most common value and its count, ties are broken by name
+func (v votes) winner() (string, int) {
+	best, count := "", -1
+	for value, n := range v {
+		if n > count || (n == count && value < best) {
+			best, count = value, n
+		}
+	}
+	return best, count
+}
+
+// counterparty collects all transactions with one IBAN or name
+type counterparty struct {
+	iban         string
+	name         string
+	example      csv.CsvTransaction
+	support      int
+	sources      votes
+	destinations votes
+	categories   votes
+	// combinations counts the transactions by source, destination and category
+	combinations votes
+}
+
+// combination separates the fields in the keys of counterparty.combinations
+const combination = "\x00"
+
+var (
+	nonWord    = regexp.MustCompile(`[^\pL\pN]+`)
+	hasDigits  = regexp.MustCompile(`\pN`)
+	legalForms = map[string]bool{"gmbh": true, "ag": true, "se": true, "kg": true, "co": true, "ltd": true, "inc": true, "ug": true, "mbh": true, "ohg": true, "ev": true, "llc": true}
+)
+
+// normalize reduces a name to the words which identify it, so that
+// "LIDL Dienstleistung GmbH & Co. KG" and "Lidl Dienstleistung" are the same.
+func normalize(name string) string {
+	words := []string{}
+	for _, word := range strings.Fields(nonWord.ReplaceAllString(strings.ToLower(name), " ")) {
+		if legalForms[word] || hasDigits.MatchString(word) {
+			continue
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " ")
+}
+
+// namePattern returns a regular expression which matches all names with the
+// normalized name, the words of it may be separated by punctuation and other
+// words, e.g. "rewe markt berlin" matches "REWE Markt 1234 Berlin".
+func namePattern(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
+	}
+	return "(?i)" + strings.Join(words, `[^\pL\pN]+(?:[\pL\pN]*[^\pL\pN]+)*?`)
+}
+
+// Learn looks at the withdrawals and deposits of the groups and suggests a
+// rule for every counterparty which is mostly booked the same way.
+func Learn(groups []firefly.FireflyTransactionGroup, options Options) []Suggestion {
+	counterparties := make(map[string]*counterparty)
+	for _, group := range groups {
+		for _, transaction := range group.Attributes.Transactions {
+			// rules are always written as if the money was spent
+			var own, other, iban string
+			amount, err := money.Parse(transaction.Amount)
+			if err != nil {
+				continue
+			}
+			switch transaction.Type {
+			case "withdrawal":
+				own, other, iban = transaction.Source, transaction.Destination, transaction.DestinationIBAN
+				amount = amount.Neg()
+			case "deposit":
+				own, other, iban = transaction.Destination, transaction.Source, transaction.SourceIBAN
+			default:
+				continue
+			}
+			if other == "" || other == options.Defaults.Destination {
+				continue
+			}
+
+			key := "iban:" + iban
+			if iban == "" {
+				key = "name:" + normalize(other)
+				if key == "name:" {
+					continue
+				}
+			}
+
+			party, ok := counterparties[key]
+			if !ok {
+				party = &counterparty{
+					iban:         iban,
+					name:         normalize(other),
+					example:      csv.CsvTransaction{Date: transaction.Date, Reciever: other, IBAN: iban, Amount: amount},
+					sources:      votes{},
+					destinations: votes{},
+					categories:   votes{},
+					combinations: votes{},
+				}
+				counterparties[key] = party
+			}
+			party.support++
+			party.sources[own]++
+			party.destinations[other]++
+			party.categories[transaction.Category]++
+			party.combinations[own+combination+other+combination+transaction.Category]++
+		}
+	}
+
+	suggestions := []Suggestion{}
+	for _, party := range counterparties {
+		suggestion, ok := party.suggest(options)
+		if ok {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Support != suggestions[j].Support {
+			return suggestions[i].Support > suggestions[j].Support
+		}
+		return describe(suggestions[i].Rule) < describe(suggestions[j].Rule)
+	})
+	return suggestions
+}
+
+func describe(rule config.Rule) string {
+	return rule.Match.IBAN + rule.Match.Reciever
+}
+
+// suggest returns the rule of the counterparty if enough transactions agree on it
+func (c *counterparty) suggest(options Options) (Suggestion, bool) {
+	if c.support < options.MinSupport {
+		return Suggestion{}, false
+	}
+	if options.Rules != nil {
+		if _, matched, err := options.Rules.Match(c.example); err != nil || matched {
+			return Suggestion{}, false
+		}
+	}
+
+	share := func(count int) float64 {
+		return float64(count) / float64(c.support)
+	}
+
+	var rule config.Rule
+	if c.iban != "" {
+		rule.Match.IBAN = c.iban
+	} else {
+		rule.Match.Reciever = namePattern(c.name)
+	}
+	// the rule has to match the transactions it was learned from
+	ruleSet, errs := config.CompileRules([]config.Rule{rule})
+	if len(errs) > 0 {
+		return Suggestion{}, false
+	}
+	if _, matched, err := ruleSet.Match(c.example); err != nil || !matched {
+		return Suggestion{}, false
+	}
+
+	destination, count := c.destinations.winner()
+	if share(count) < options.MinConfidence {
+		return Suggestion{}, false
+	}
+	rule.Data.Destination = destination
+
+	// source and category are only set if the transactions agree on them
+	source, count := c.sources.winner()
+	if share(count) >= options.MinConfidence && source != options.Defaults.Source {
+		rule.Data.Source = source
+	}
+	category, count := c.categories.winner()
+	if share(count) >= options.MinConfidence {
+		rule.Data.Category = category
+	}
+
+	suggestion := Suggestion{Rule: rule, Support: c.support}
+	for key, count := range c.combinations {
+		parts := strings.Split(key, combination)
+		if (rule.Data.Source == "" || parts[0] == rule.Data.Source) && parts[1] == rule.Data.Destination &&
+			(rule.Data.Category == "" || parts[2] == rule.Data.Category) {
+			suggestion.Agreeing += count
+		}
+	}
+	return suggestion, suggestion.Confidence() >= options.MinConfidence
+}
+
+// Write writes the suggestions as a list of rules which can be copied into
+// the config, every rule has a comment with its confidence and support.
+func Write(w io.Writer, suggestions []Suggestion) error {
+	list := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, suggestion := range suggestions {
+		var node yaml.Node
+		if err := node.Encode(suggestion.Rule); err != nil {
+			return err
+		}
+		node.HeadComment = fmt.Sprintf("confidence %.0f%%, %d of %d transactions", suggestion.Confidence()*100, suggestion.Agreeing, suggestion.Support)
+		list.Content = append(list.Content, &node)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(list); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
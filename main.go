@@ -1,60 +1,141 @@
 package main
 
 import (
+	"errors"
 	"fireflysync/internal/config"
-	"fireflysync/internal/csv"
 	"fireflysync/internal/firefly"
-	"fireflysync/internal/helper"
+	"fireflysync/internal/ledger"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 )
 
-func main() {
-	var (
-		csvFile    string
-		configFile string
-		dryRun     bool
-		noMatch    bool
-	)
-	flag.StringVar(&csvFile, "csv", "", "Path to a CSV file to import")
-	flag.StringVar(&configFile, "config", "config.yaml", "Path to a config file")
-	flag.BoolVar(&dryRun, "dry-run", false, "Dry run")
-	flag.BoolVar(&noMatch, "show-no-match", false, "Show only transactions that doesn't match any rules. Usefull with -dry-run")
-	flag.Parse()
-
-	if csvFile == "" {
-		log.Fatal("csv file must be provided")
-	}
-
-	config := config.GetConfig(configFile)
-	transactions := csv.LoadTransactions(csvFile)
-	client := firefly.NewClient(config.URL, config.Token)
-
-	for _, transaction := range transactions {
-		outputTransaction := firefly.ProcessTransaction(transaction, config.Rules, config.Defaults)
-
-		id, err := client.GetTransaction(outputTransaction)
-		if err != nil {
-			log.Fatal(err)
-		}
+// Exit codes of all commands
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
 
-		if id >= 0 {
-			fmt.Println("Transaction already exists, skipping", id)
-			continue
-		}
+// errUsage is returned by commands which were called with invalid arguments,
+// the usage was already printed at that point.
+var errUsage = errors.New("invalid usage")
 
-		if !dryRun {
-			err := client.PushTransaction(outputTransaction)
-			if err != nil {
-				log.Fatal(err)
-			}
-		}
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
 
-		if noMatch && outputTransaction.RuleMatch {
+var commands = []command{
+	{"import", "Import transactions from a CSV file", importCommand},
+	{"undo", "Delete all transactions created by an import run", undoCommand},
+	{"runs list", "List all import runs", runsListCommand},
+	{"rules test", "Run rule tests or show which rules match a CSV file", rulesTestCommand},
+	{"rules lint", "Check the rules for mistakes", rulesLintCommand},
+	{"rules add", "Add rules for transactions which don't match any rule", rulesAddCommand},
+	{"rules suggest", "Suggest rules learned from the transactions in Firefly III", rulesSuggestCommand},
+	{"config validate", "Check the config file for mistakes", configValidateCommand},
+	{"accounts list", "List the accounts of Firefly III", accountsListCommand},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: fireflysync <command> [flags]\n\nCommands:\n")
+	for _, command := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", command.name, command.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nUse \"fireflysync <command> -h\" for the flags of a command.\n")
+}
+
+// findCommand returns the command named by the first one or two arguments
+// and the remaining arguments.
+func findCommand(args []string) (command, []string, bool) {
+	for _, command := range commands {
+		words := strings.Fields(command.name)
+		if len(args) < len(words) {
 			continue
 		}
+		if strings.Join(args[:len(words)], " ") == command.name {
+			return command, args[len(words):], true
+		}
+	}
+	return command{}, nil, false
+}
+
+// newFlagSet creates the flag set of a command including the flags shared by all commands
+func newFlagSet(name, arguments, description string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := flags.String("config", "config.yaml", "Path to a config file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: fireflysync %s [flags] %s\n\n%s\n\nFlags:\n", name, arguments, description)
+		flags.PrintDefaults()
+	}
+	return flags, configFile
+}
+
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if err != nil && err != flag.ErrHelp {
+		return errUsage
+	}
+	return err
+}
+
+// usageError prints the message and the usage of the command
+func usageError(flags *flag.FlagSet, format string, args ...interface{}) error {
+	fmt.Fprintf(flags.Output(), format+"\n\n", args...)
+	flags.Usage()
+	return errUsage
+}
+
+func newClient(cfg config.Config) *firefly.Client {
+	client := firefly.NewClient(cfg.URL, cfg.Token)
+	client.DuplicateWindow = cfg.DuplicateWindow
+	if cfg.HTTP.Timeout > 0 {
+		client.HTTPClient.Timeout = cfg.HTTP.Timeout
+	}
+	if cfg.HTTP.Retries != nil {
+		client.Retries = *cfg.HTTP.Retries
+	}
+	if cfg.HTTP.Backoff > 0 {
+		client.Backoff = cfg.HTTP.Backoff
+	}
+	if cfg.HTTP.MaxBackoff > 0 {
+		client.MaxBackoff = cfg.HTTP.MaxBackoff
+	}
+	client.SetRateLimit(cfg.HTTP.RateLimit)
+	return client
+}
+
+func openLedger(cfg config.Config) (*ledger.Ledger, error) {
+	return ledger.Open(cfg.LedgerPath())
+}
+
+func main() {
+	log.SetFlags(0)
+
+	args := os.Args[1:]
+	// calling the tool with flags only is the old way to import a file
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "-help" && args[0] != "--help" {
+		args = append([]string{"import"}, args...)
+	}
+
+	command, args, ok := findCommand(args)
+	if !ok {
+		usage()
+		os.Exit(exitUsage)
+	}
 
-		helper.PrintTransaction(transaction, outputTransaction)
+	err := command.run(args)
+	switch {
+	case err == nil, err == flag.ErrHelp:
+		os.Exit(exitOK)
+	case err == errUsage:
+		os.Exit(exitUsage)
+	default:
+		log.Println("Error:", err)
+		os.Exit(exitError)
 	}
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fireflysync/internal/report"
+	"flag"
+	"os"
+)
+
+// reportOptions are the flags of commands which can write a rule report
+type reportOptions struct {
+	format string
+	file   string
+}
+
+func addReportFlags(flags *flag.FlagSet) *reportOptions {
+	options := &reportOptions{}
+	flags.StringVar(&options.format, "report", "", "Write a report of the rules at the end, either \"table\" or \"json\"")
+	flags.StringVar(&options.file, "report-file", "", "Write the report to this file instead of the terminal")
+	return options
+}
+
+func (o *reportOptions) validate(flags *flag.FlagSet) error {
+	switch o.format {
+	case "", "table", "json":
+	default:
+		return usageError(flags, "unknown report format %q", o.format)
+	}
+	if o.file != "" && o.format == "" {
+		return usageError(flags, "-report-file requires -report")
+	}
+	return nil
+}
+
+// write writes the report if one was requested
+func (o *reportOptions) write(stats *report.Report) error {
+	if o.format == "" {
+		return nil
+	}
+	if o.file == "" {
+		return stats.Write(os.Stdout, o.format)
+	}
+
+	file, err := os.Create(o.file)
+	if err != nil {
+		return err
+	}
+	if err := stats.Write(file, o.format); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fireflysync/internal/config"
+	"fireflysync/internal/csv"
+	"fireflysync/internal/firefly"
+	"fireflysync/internal/helper"
+	"fireflysync/internal/report"
+	"fireflysync/internal/ruletest"
+	"fmt"
+)
+
+func rulesTestCommand(args []string) error {
+	var (
+		csvFile string
+		profile string
+		noMatch bool
+	)
+	flags, configFile := newFlagSet("rules test", "[test files...]", "Runs the rule tests of the given files and reports all fields which don't\nhave the expected value. With -csv the rules are applied to the transactions\nof a CSV file instead and the result is shown. Firefly III isn't contacted.")
+	flags.StringVar(&csvFile, "csv", "", "Path to a CSV file")
+	flags.StringVar(&profile, "profile", "", "Name of the csv profile from the config file")
+	flags.BoolVar(&noMatch, "show-no-match", false, "Show only transactions that doesn't match any rules")
+	reportOptions := addReportFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if err := reportOptions.validate(flags); err != nil {
+		return err
+	}
+	if csvFile != "" && flags.NArg() > 0 {
+		return usageError(flags, "either a csv file or test files must be provided, not both")
+	}
+	if csvFile == "" && flags.NArg() == 0 {
+		return usageError(flags, "a csv file or test files must be provided")
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return runRuleTests(cfg, flags.Args())
+	}
+
+	csvProfile, err := cfg.Profile(profile)
+	if err != nil {
+		return err
+	}
+	transactions, err := csv.ReadFile(csvFile, csvProfile)
+	if err != nil {
+		return err
+	}
+
+	stats := report.New(cfg.Rules)
+	for _, transaction := range transactions {
+		outputTransaction, err := firefly.ProcessTransaction(transaction, cfg.RuleSet, cfg.Defaults)
+		if err != nil {
+			return err
+		}
+		stats.Add(transaction, outputTransaction)
+		// the report replaces the tables of the single transactions
+		if reportOptions.format != "" && reportOptions.file == "" {
+			continue
+		}
+		if noMatch && outputTransaction.RuleMatch {
+			continue
+		}
+		helper.PrintTransaction(transaction, outputTransaction)
+	}
+
+	return reportOptions.write(stats)
+}
+
+// runRuleTests runs all test cases of the files and prints the result of each
+func runRuleTests(cfg config.Config, files []string) error {
+	total, failed := 0, 0
+	for _, file := range files {
+		cases, err := ruletest.Load(file)
+		if err != nil {
+			return err
+		}
+
+		for _, test := range cases {
+			total++
+			diffs, err := test.Run(cfg.RuleSet, cfg.Defaults)
+			if err != nil {
+				failed++
+				fmt.Printf("FAIL %s: %s\n    %s\n", file, test.Name, err)
+				continue
+			}
+			if len(diffs) > 0 {
+				failed++
+				fmt.Printf("FAIL %s: %s\n", file, test.Name)
+				for _, diff := range diffs {
+					fmt.Println("    " + diff.String())
+				}
+				continue
+			}
+			fmt.Printf("ok   %s: %s\n", file, test.Name)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, total)
+	}
+	fmt.Printf("all %d tests passed\n", total)
+	return nil
+}
+
+func rulesLintCommand(args []string) error {
+	var (
+		csvFile string
+		profile string
+	)
+	flags, configFile := newFlagSet("rules lint", "", "Checks the rules of the config file for mistakes, like duplicate IBANs,\noverlapping patterns and rules which are never applied. With -csv the\nrules are also applied to a CSV file to find rules which never match.")
+	flags.StringVar(&csvFile, "csv", "", "Path to a CSV file with sample transactions")
+	flags.StringVar(&profile, "profile", "", "Name of the csv profile from the config file")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usageError(flags, "too many arguments")
+	}
+
+	cfg, err := config.Load(*configFile)
+	var configErr *config.ConfigError
+	if err != nil && !errors.As(err, &configErr) {
+		return err
+	}
+
+	// only the problems of the rules are of interest here
+	problems := []error{}
+	if configErr != nil {
+		for _, err := range configErr.Errors {
+			var ruleErr config.RuleError
+			if errors.As(err, &ruleErr) {
+				problems = append(problems, err)
+			}
+		}
+	}
+	// the rules can only be analysed further if all of them are valid
+	if len(problems) == 0 {
+		problems = append(problems, cfg.Lint()...)
+
+		if csvFile != "" {
+			csvProfile, err := cfg.Profile(profile)
+			if err != nil {
+				return err
+			}
+			transactions, err := csv.ReadFile(csvFile, csvProfile)
+			if err != nil {
+				return err
+			}
+			unmatched, err := cfg.LintTransactions(transactions)
+			if err != nil {
+				return err
+			}
+			problems = append(problems, unmatched...)
+		}
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems in %d rules", len(problems), len(cfg.Rules))
+	}
+
+	fmt.Printf("%d rules are fine\n", len(cfg.Rules))
+	return nil
+}
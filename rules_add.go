@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fireflysync/internal/config"
+	"fireflysync/internal/csv"
+	"fireflysync/internal/firefly"
+	"fireflysync/internal/helper"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// errQuit is returned by the prompts if the user wants to stop
+var errQuit = errors.New("quit")
+
+// prompter asks questions on the terminal
+type prompter struct {
+	reader *bufio.Reader
+}
+
+// ask prints the question and returns the answer or the fallback if the answer is empty
+func (p *prompter) ask(question, fallback string) (string, error) {
+	if fallback != "" {
+		fmt.Printf("%s [%s]: ", question, fallback)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+
+	answer, err := p.reader.ReadString('\n')
+	if err == io.EOF && answer == "" {
+		fmt.Println()
+		return "", errQuit
+	}
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return fallback, nil
+	}
+	return answer, nil
+}
+
+func (p *prompter) confirm(question string, fallback bool) (bool, error) {
+	hint := "y/N"
+	if fallback {
+		hint = "Y/n"
+	}
+	answer, err := p.ask(fmt.Sprintf("%s [%s]", question, hint), "")
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "":
+		return fallback, nil
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// choose asks for one of the options. The answer can be the number of an
+// option, its name or a part of its name. Names which aren't an option have
+// to be confirmed, even if it's the fallback, and "-" leaves the value empty.
+func (p *prompter) choose(label string, options []string, fallback string) (string, error) {
+	list := func(options []string) {
+		for i, option := range options {
+			fmt.Printf("  %3d) %s\n", i+1, option)
+		}
+	}
+
+	for {
+		answer, err := p.ask(label+" (number, name, ? to list, - for none)", fallback)
+		if err != nil {
+			return "", err
+		}
+
+		switch answer {
+		case "", "-":
+			return "", nil
+		case "?":
+			list(options)
+			continue
+		}
+
+		if number, err := strconv.Atoi(answer); err == nil {
+			if number < 1 || number > len(options) {
+				fmt.Printf("There is no option %d\n", number)
+				continue
+			}
+			return options[number-1], nil
+		}
+
+		candidates := []string{}
+		for _, option := range options {
+			if strings.EqualFold(option, answer) {
+				return option, nil
+			}
+			if strings.Contains(strings.ToLower(option), strings.ToLower(answer)) {
+				candidates = append(candidates, option)
+			}
+		}
+		if len(candidates) == 1 {
+			return candidates[0], nil
+		}
+		if len(candidates) > 1 {
+			list(candidates)
+			options = candidates
+			continue
+		}
+
+		ok, err := p.confirm(fmt.Sprintf("%q doesn't exist in Firefly III yet, use it anyway?", answer), false)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return answer, nil
+		}
+	}
+}
+
+// ruleOptions are the names which can be chosen for a new rule
+type ruleOptions struct {
+	assets     []string
+	expenses   []string
+	revenues   []string
+	categories []string
+}
+
+func loadRuleOptions(client *firefly.Client) (ruleOptions, error) {
+	var options ruleOptions
+	accountNames := func(accountType string) ([]string, error) {
+		accounts, err := client.ListAccounts(accountType)
+		if err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for _, account := range accounts {
+			if account.Attributes.Active {
+				names = append(names, account.Attributes.Name)
+			}
+		}
+		return names, nil
+	}
+
+	var err error
+	if options.assets, err = accountNames("asset"); err != nil {
+		return options, err
+	}
+	if options.expenses, err = accountNames("expense"); err != nil {
+		return options, err
+	}
+	if options.revenues, err = accountNames("revenue"); err != nil {
+		return options, err
+	}
+
+	categories, err := client.ListCategories()
+	if err != nil {
+		return options, err
+	}
+	for _, category := range categories {
+		options.categories = append(options.categories, category.Attributes.Name)
+	}
+	return options, nil
+}
+
+// proposeRule asks how the transaction should be matched and which data the
+// rule sets. ok is false if the transaction should be skipped.
+func proposeRule(p *prompter, transaction csv.CsvTransaction, options ruleOptions, defaults config.Defaults) (config.Rule, bool, error) {
+	var rule config.Rule
+
+	pattern := regexp.QuoteMeta(transaction.Reciever)
+	choices, fallback := []string{}, ""
+	if transaction.IBAN != "" {
+		choices = append(choices, fmt.Sprintf("[i]ban %s", transaction.IBAN))
+		fallback = "i"
+	}
+	if transaction.Reciever != "" {
+		choices = append(choices, fmt.Sprintf("[r]eciever '%s'", pattern))
+		if fallback == "" {
+			fallback = "r"
+		}
+	}
+	if fallback == "" {
+		fmt.Println("The transaction has neither an IBAN nor a reciever, skipping")
+		return rule, false, nil
+	}
+
+	answer, err := p.ask(fmt.Sprintf("Match by %s, [s]kip or [q]uit?", strings.Join(choices, ", ")), fallback)
+	if err != nil {
+		return rule, false, err
+	}
+	switch {
+	case answer == "i" && transaction.IBAN != "":
+		rule.Match.IBAN = transaction.IBAN
+	case answer == "r" && transaction.Reciever != "":
+		for {
+			pattern, err = p.ask("Regular expression for the reciever", pattern)
+			if err != nil {
+				return rule, false, err
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			break
+		}
+		rule.Match.Reciever = pattern
+	case answer == "q":
+		return rule, false, errQuit
+	default:
+		return rule, false, nil
+	}
+
+	// rules are always written as if the money was spent
+	counterparts := options.expenses
+	if transaction.Amount.Sign() > 0 {
+		counterparts = options.revenues
+	}
+
+	source, err := p.choose("Source", options.assets, defaults.Source)
+	if err != nil {
+		return rule, false, err
+	}
+	if source != defaults.Source {
+		rule.Data.Source = source
+	}
+	if rule.Data.Destination, err = p.choose("Destination", counterparts, transaction.Reciever); err != nil {
+		return rule, false, err
+	}
+	if rule.Data.Category, err = p.choose("Category", options.categories, ""); err != nil {
+		return rule, false, err
+	}
+	return rule, true, nil
+}
+
+func rulesAddCommand(args []string) error {
+	var (
+		csvFile string
+		profile string
+	)
+	flags, configFile := newFlagSet("rules add", "", "Asks for a rule for every transaction of a CSV file which doesn't match\nany rule yet and adds the rules to the config file. Comments and the\nformatting of the config file are kept.")
+	flags.StringVar(&csvFile, "csv", "", "Path to a CSV file")
+	flags.StringVar(&profile, "profile", "", "Name of the csv profile from the config file")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usageError(flags, "too many arguments")
+	}
+	if csvFile == "" {
+		return usageError(flags, "csv file must be provided")
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return err
+	}
+	csvProfile, err := cfg.Profile(profile)
+	if err != nil {
+		return err
+	}
+	transactions, err := csv.ReadFile(csvFile, csvProfile)
+	if err != nil {
+		return err
+	}
+
+	options, err := loadRuleOptions(newClient(cfg))
+	if err != nil {
+		return err
+	}
+
+	p := &prompter{reader: bufio.NewReader(os.Stdin)}
+	asked := make(map[string]bool)
+	added := 0
+	for _, transaction := range transactions {
+		outputTransaction, err := firefly.ProcessTransaction(transaction, cfg.RuleSet, cfg.Defaults)
+		if err != nil {
+			return err
+		}
+		// only ask once for every reciever
+		key := transaction.IBAN + "|" + transaction.Reciever
+		if len(outputTransaction.Rules) > 0 || asked[key] {
+			continue
+		}
+		asked[key] = true
+
+		helper.PrintTransaction(transaction, outputTransaction)
+		rule, ok, err := proposeRule(p, transaction, options, cfg.Defaults)
+		if err == errQuit {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		text, err := config.MarshalRule(rule)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\n%s\n", text)
+		ok, err = p.confirm(fmt.Sprintf("Add this rule to %s?", *configFile), true)
+		if err == errQuit {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		if err := config.AppendRule(*configFile, rule); err != nil {
+			return err
+		}
+		added++
+		// the new rule might match some of the following transactions
+		if cfg, err = config.Load(*configFile); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Added %d rules to %s\n", added, *configFile)
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fireflysync/internal/config"
+	"fireflysync/internal/suggest"
+	"fmt"
+	"os"
+	"time"
+)
+
+func rulesSuggestCommand(args []string) error {
+	var (
+		start         string
+		end           string
+		minSupport    int
+		minConfidence float64
+		all           bool
+	)
+	now := time.Now()
+	flags, configFile := newFlagSet("rules suggest", "", "Learns rules from the existing transactions in Firefly III. For every IBAN\nor name of a counterparty the most common destination, source and category\nare suggested, together with the confidence and number of transactions.")
+	flags.StringVar(&start, "start", now.AddDate(-2, 0, 0).Format("2006-01-02"), "First day of the transactions to learn from")
+	flags.StringVar(&end, "end", now.Format("2006-01-02"), "Last day of the transactions to learn from")
+	flags.IntVar(&minSupport, "min-support", 3, "Number of transactions a counterparty needs at least")
+	flags.Float64Var(&minConfidence, "min-confidence", 0.8, "Share of the transactions which have to agree with a rule, between 0 and 1")
+	flags.BoolVar(&all, "all", false, "Also suggest rules for counterparties which already match a rule")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usageError(flags, "too many arguments")
+	}
+	startDate, err := time.Parse("2006-01-02", start)
+	if err != nil {
+		return usageError(flags, "invalid start date %q", start)
+	}
+	endDate, err := time.Parse("2006-01-02", end)
+	if err != nil {
+		return usageError(flags, "invalid end date %q", end)
+	}
+	if minConfidence < 0 || minConfidence > 1 {
+		return usageError(flags, "min-confidence must be between 0 and 1")
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return err
+	}
+
+	groups, err := newClient(cfg).ListTransactions(startDate, endDate)
+	if err != nil {
+		return err
+	}
+
+	options := suggest.Options{
+		MinSupport:    minSupport,
+		MinConfidence: minConfidence,
+		Defaults:      cfg.Defaults,
+		Rules:         cfg.RuleSet,
+	}
+	if all {
+		options.Rules = nil
+	}
+	suggestions := suggest.Learn(groups, options)
+	if len(suggestions) == 0 {
+		fmt.Fprintln(os.Stderr, "No rules to suggest")
+		return nil
+	}
+
+	fmt.Printf("# %d rules learned from the transactions between %s and %s\n", len(suggestions), start, end)
+	return suggest.Write(os.Stdout, suggestions)
+}
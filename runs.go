@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fireflysync/internal/config"
+	"fireflysync/internal/ledger"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+func runsListCommand(args []string) error {
+	flags, configFile := newFlagSet("runs list", "", "Lists all import runs recorded in the ledger.")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usageError(flags, "too many arguments")
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return err
+	}
+	importLedger, err := openLedger(cfg)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]map[ledger.Status]int)
+	for _, entry := range importLedger.Entries {
+		if counts[entry.RunID] == nil {
+			counts[entry.RunID] = make(map[ledger.Status]int)
+		}
+		counts[entry.RunID][entry.Status]++
+	}
+
+	ids := make([]string, 0, len(importLedger.Runs))
+	for id := range importLedger.Runs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return importLedger.Runs[ids[i]].StartedAt.Before(importLedger.Runs[ids[j]].StartedAt)
+	})
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Run", "Started", "CSV", "Imported", "Duplicates", "Failed"})
+	for _, id := range ids {
+		run := importLedger.Runs[id]
+		table.Append([]string{
+			id,
+			run.StartedAt.Format("2006-01-02 15:04:05"),
+			run.CSV,
+			strconv.Itoa(counts[id][ledger.StatusImported]),
+			strconv.Itoa(counts[id][ledger.StatusDuplicate]),
+			strconv.Itoa(counts[id][ledger.StatusFailed]),
+		})
+	}
+	table.Render()
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fireflysync/internal/config"
+	"fireflysync/internal/firefly"
+	"fireflysync/internal/ledger"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+func undoCommand(args []string) error {
+	var yes bool
+	flags, configFile := newFlagSet("undo", "<run-id>", "Deletes all transactions which were created by the given import run. Use\n\"fireflysync runs list\" to find the ID of a run.")
+	flags.BoolVar(&yes, "yes", false, "Don't ask for confirmation")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return usageError(flags, "undo expects exactly one run ID")
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return err
+	}
+	importLedger, err := openLedger(cfg)
+	if err != nil {
+		return err
+	}
+
+	return undo(importLedger, newClient(cfg), flags.Arg(0), yes)
+}
+
+// undo deletes all transactions which were created by the given import run
+func undo(importLedger *ledger.Ledger, client *firefly.Client, runID string, yes bool) error {
+	if _, ok := importLedger.Runs[runID]; !ok {
+		return fmt.Errorf("run %q not found", runID)
+	}
+
+	entries := importLedger.RunEntries(runID)
+	fingerprints := make([]string, 0, len(entries))
+	for fingerprint := range entries {
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	sort.Slice(fingerprints, func(i, j int) bool {
+		return entries[fingerprints[i]].FireflyID < entries[fingerprints[j]].FireflyID
+	})
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"ID", "Date", "Amount", "Description"})
+	for _, fingerprint := range fingerprints {
+		entry := entries[fingerprint]
+		table.Append([]string{strconv.Itoa(entry.FireflyID), entry.Date, entry.Amount, entry.Description})
+	}
+	table.Render()
+
+	if !yes {
+		fmt.Printf("Delete %d transactions of run %s? [y/N] ", len(fingerprints), runID)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+
+	for _, fingerprint := range fingerprints {
+		entry := entries[fingerprint]
+		err := client.DeleteTransaction(entry.FireflyID)
+		// a transaction which doesn't exist anymore was already deleted by hand
+		var notFound *firefly.NotFoundError
+		if err != nil && !errors.As(err, &notFound) {
+			return err
+		}
+		if err := importLedger.Forget(fingerprint); err != nil {
+			return err
+		}
+		if notFound != nil {
+			fmt.Println("Transaction was already deleted, ID: ", entry.FireflyID)
+		} else {
+			fmt.Println("Transaction deleted with ID: ", entry.FireflyID)
+		}
+	}
+
+	return importLedger.RemoveRun(runID)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fireflysync/internal/config"
+	"fmt"
+)
+
+func configValidateCommand(args []string) error {
+	flags, configFile := newFlagSet("config validate", "", "Checks the config file for mistakes like missing settings or invalid rules.")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usageError(flags, "too many arguments")
+	}
+
+	// all problems are reported at once by Load
+	if _, err := config.Load(*configFile); err != nil {
+		return err
+	}
+
+	fmt.Println(*configFile, "is valid")
+	return nil
+}